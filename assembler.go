@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Hack instruction fields.
+var (
+	hackComp = map[string]string{
+		"0": "0101010", "1": "0111111", "-1": "0111010", "D": "0001100",
+		"A": "0110000", "!D": "0001101", "!A": "0110001", "-D": "0001111",
+		"-A": "0110011", "D+1": "0011111", "A+1": "0110111", "D-1": "0001110",
+		"A-1": "0110010", "D+A": "0000010", "D-A": "0010011", "A-D": "0000111",
+		"D&A": "0000000", "D|A": "0010101",
+		"M": "1110000", "!M": "1110001", "-M": "1110011", "M+1": "1110111",
+		"M-1": "1110010", "D+M": "1000010", "D-M": "1010011", "M-D": "1000111",
+		"D&M": "1000000", "D|M": "1010101",
+		// commutative spellings
+		"A+D": "0000010", "M+D": "1000010", "A&D": "0000000", "M&D": "1000000",
+		"A|D": "0010101", "M|D": "1010101",
+	}
+	hackJump = map[string]string{
+		"": "000", "JGT": "001", "JEQ": "010", "JGE": "011",
+		"JLT": "100", "JNE": "101", "JLE": "110", "JMP": "111",
+	}
+	hackSymbols = map[string]int{
+		"SP": ramSP, "LCL": ramLCL, "ARG": ramARG, "THIS": ramTHIS, "THAT": ramTHAT,
+		"SCREEN": ramScreen, "KBD": ramKeyboard,
+	}
+)
+
+const hackROMSize = 32768
+
+// assemble translates Hack assembly to binary instructions, one 16-character
+// line of 0s and 1s each. Labels are resolved in a first pass; other
+// symbols become variables from address 16 in order of appearance.
+func assemble(lines []string) ([]string, error) {
+	symbols := map[string]int{}
+	for name, addr := range hackSymbols {
+		symbols[name] = addr
+	}
+	for i := range 16 {
+		symbols["R"+strconv.Itoa(i)] = i
+	}
+
+	type instruction struct {
+		text string
+		line int
+	}
+	instructions := []instruction{}
+	for i, line := range lines {
+		line, _, _ = strings.Cut(line, "//")
+		line = strings.Join(strings.Fields(line), "")
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "("):
+			label := strings.TrimSuffix(line[1:], ")")
+			if !strings.HasSuffix(line, ")") || !isHackSymbol(label) {
+				return nil, fmt.Errorf("line %d: invalid label %s", i+1, line)
+			}
+			if _, ok := symbols[label]; ok {
+				return nil, fmt.Errorf("line %d: symbol %s is defined twice", i+1, label)
+			}
+			symbols[label] = len(instructions)
+		default:
+			instructions = append(instructions, instruction{line, i + 1})
+		}
+	}
+	if len(instructions) > hackROMSize {
+		return nil, fmt.Errorf("the program has %d instructions, more than the %d words of ROM", len(instructions), hackROMSize)
+	}
+
+	binary := make([]string, 0, len(instructions))
+	variable := ramStatic
+	for _, in := range instructions {
+		if value, ok := strings.CutPrefix(in.text, "@"); ok {
+			addr, err := strconv.Atoi(value)
+			switch {
+			case err == nil && (addr < 0 || addr > maxIntConst):
+				return nil, fmt.Errorf("line %d: constant %s is out of the 0..%d range", in.line, value, maxIntConst)
+			case err != nil && !isHackSymbol(value):
+				return nil, fmt.Errorf("line %d: invalid symbol %s", in.line, value)
+			case err != nil:
+				var known bool
+				if addr, known = symbols[value]; !known {
+					if variable >= ramScreen {
+						return nil, fmt.Errorf("line %d: too many variables", in.line)
+					}
+					addr = variable
+					symbols[value] = addr
+					variable++
+				}
+			}
+			binary = append(binary, fmt.Sprintf("%016b", addr))
+			continue
+		}
+		code, err := assembleC(in.text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", in.line, err)
+		}
+		binary = append(binary, code)
+	}
+	return binary, nil
+}
+
+// assembleC encodes a dest=comp;jump instruction.
+func assembleC(text string) (string, error) {
+	dest, rest, hasDest := strings.Cut(text, "=")
+	if !hasDest {
+		dest, rest = "", text
+	}
+	comp, jump, _ := strings.Cut(rest, ";")
+	compBits, ok := hackComp[comp]
+	if !ok {
+		return "", fmt.Errorf("invalid computation %s", comp)
+	}
+	jumpBits, ok := hackJump[jump]
+	if !ok {
+		return "", fmt.Errorf("invalid jump %s", jump)
+	}
+	destBits := []byte("000")
+	for _, r := range dest {
+		i := strings.IndexRune("ADM", r)
+		if i < 0 || destBits[i] == '1' {
+			return "", fmt.Errorf("invalid destination %s", dest)
+		}
+		destBits[i] = '1'
+	}
+	return "111" + compBits + string(destBits) + jumpBits, nil
+}
+
+// isHackSymbol accepts letters, digits, _, ., $ and :, not starting with a
+// digit.
+func isHackSymbol(s string) bool {
+	if s == "" || s[0] >= '0' && s[0] <= '9' {
+		return false
+	}
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("_.$:", r)) {
+			return false
+		}
+	}
+	return true
+}
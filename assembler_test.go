@@ -0,0 +1,59 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestAssemble(t *testing.T) {
+	tests := []struct {
+		name string
+		asm  []string
+		want []string
+	}{
+		{"constant", []string{"@5"}, []string{"0000000000000101"}},
+		{"largest constant", []string{"@32767"}, []string{"0111111111111111"}},
+		{"predefined symbols", []string{"@SP", "@THAT", "@R15", "@SCREEN", "@KBD"},
+			[]string{"0000000000000000", "0000000000000100", "0000000000001111", "0100000000000000", "0110000000000000"}},
+		{"computation", []string{"D=M", "AM=M-1", "M=D+M", "D=D|A", "0;JMP", "D;JGT", "AMD=!D;JLE"},
+			[]string{"1111110000010000", "1111110010101000", "1111000010001000", "1110010101010000",
+				"1110101010000111", "1110001100000001", "1110001101111110"}},
+		{"commutative spelling", []string{"M=M+D"}, []string{"1111000010001000"}},
+		{"labels and variables", []string{"// count down", "@i", "M=1", "(LOOP)", "@j", "@LOOP", "0;JMP", "@i"},
+			[]string{"0000000000010000", "1110111111001000", "0000000000010001", "0000000000000010",
+				"1110101010000111", "0000000000010000"}},
+		{"forward label", []string{"@END", "0;JMP", "(END)", "@END"},
+			[]string{"0000000000000010", "1110101010000111", "0000000000000010"}},
+	}
+	for _, tt := range tests {
+		got, err := assemble(tt.asm)
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: assemble = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAssembleErrors(t *testing.T) {
+	tests := []struct {
+		asm []string
+		err string
+	}{
+		{[]string{"@32768"}, "line 1: constant 32768 is out of the 0..32767 range"},
+		{[]string{"@1x"}, "line 1: invalid symbol 1x"},
+		{[]string{"D=X"}, "line 1: invalid computation X"},
+		{[]string{"D;JXX"}, "line 1: invalid jump JXX"},
+		{[]string{"DD=A"}, "line 1: invalid destination DD"},
+		{[]string{"(LOOP)", "(LOOP)"}, "line 2: symbol LOOP is defined twice"},
+		{[]string{"(SP)"}, "line 1: symbol SP is defined twice"},
+		{[]string{"(LOOP"}, "line 1: invalid label (LOOP"},
+	}
+	for _, tt := range tests {
+		if _, err := assemble(tt.asm); err == nil || err.Error() != tt.err {
+			t.Errorf("%q: error %v, want %q", tt.asm, err, tt.err)
+		}
+	}
+}
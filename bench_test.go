@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// benchLines is the size of the synthetic program the benchmarks run on.
+const benchLines = 10000
+
+// syntheticProgram generates a class of at least the given number of lines,
+// repeating a method that exercises every statement, most expression forms,
+// comments and string constants.
+func syntheticProgram(lines int) string {
+	var sb strings.Builder
+	sb.WriteString("/** Generated for the benchmarks. */\nclass Bench {\n")
+	sb.WriteString("    field int x, y;\n    static Array cells;\n\n")
+	n := 6
+	for i := 0; n < lines; i++ {
+		fmt.Fprintf(&sb, `    /** Sums the cells up to a, scaled by b. */
+    method int sum%d(int a, int b) {
+        var int i, sum;
+        var String s;
+        let i = 0; // start at the first cell
+        while (i < a) {
+            let sum = sum + (cells[i] * b) - (i / 2);
+            if ((sum > %d) & ~(i = b)) {
+                let s = "partial sum %d";
+                do Output.printString(s);
+            } else {
+                let x = Math.max(x, -sum);
+                do draw(x, y, true);
+            }
+            /* next cell */
+            let i = i + 1;
+        }
+        return sum;
+    }
+
+`, i, i%32768, i)
+		n += 20
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+// benchTokenizer tokenizes the synthetic program, outside of the
+// measurement.
+func benchTokenizer(b *testing.B, src string) *Tokenizer {
+	b.Helper()
+	tokenizer, err := NewTokenizer(src)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return tokenizer
+}
+
+func BenchmarkTokenize(b *testing.B) {
+	src := syntheticProgram(benchLines)
+	b.SetBytes(int64(len(src)))
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := NewTokenizer(src); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParse(b *testing.B) {
+	src := syntheticProgram(benchLines)
+	tokenizer := benchTokenizer(b, src)
+	b.SetBytes(int64(len(src)))
+	b.ReportAllocs()
+	for b.Loop() {
+		if err := NewCompilationEngine(tokenizer, nil).ProcessClass(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkXML measures writing a parsed tree through the indenting writer.
+func BenchmarkXML(b *testing.B) {
+	src := syntheticProgram(benchLines)
+	ce := NewCompilationEngine(benchTokenizer(b, src), nil)
+	if err := ce.ProcessClass(); err != nil {
+		b.Fatal(err)
+	}
+	tree := ce.Tree()
+	b.SetBytes(int64(len(src)))
+	b.ReportAllocs()
+	for b.Loop() {
+		var buf bytes.Buffer
+		tree.WriteXML(NewXMLWriter(&buf, "  ", "\n"))
+	}
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Graph is a directed graph of subroutines or classes. Nodes outside the
+// project, such as the OS classes, are marked external.
+type Graph struct {
+	Name     string
+	nodes    map[string]bool // node -> external
+	edges    map[string]map[string]int
+	cycles   [][]string
+	uncalled []string
+}
+
+func newGraph(name string) *Graph {
+	return &Graph{Name: name, nodes: map[string]bool{}, edges: map[string]map[string]int{}}
+}
+
+func (g *Graph) addNode(id string, external bool) {
+	if _, ok := g.nodes[id]; !ok || !external {
+		g.nodes[id] = external
+	}
+}
+
+func (g *Graph) addEdge(from, to string) {
+	if g.edges[from] == nil {
+		g.edges[from] = map[string]int{}
+	}
+	g.edges[from][to]++
+}
+
+func (g *Graph) sortedNodes() []string {
+	ids := []string{}
+	for id := range g.nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (g *Graph) successors(id string) []string {
+	ids := []string{}
+	for to := range g.edges[id] {
+		ids = append(ids, to)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// buildCallGraph links every subroutine of the project to the subroutines it
+// calls, from the subroutine call sites of each class.
+func buildCallGraph(classes []*ClassDecl) *Graph {
+	g := newGraph("calls")
+	project := map[string]bool{}
+	for _, cd := range classes {
+		project[cd.Name] = true
+		for _, sd := range cd.Subroutines {
+			g.addNode(cd.Name+"."+sd.Name, false)
+		}
+	}
+	for _, cd := range classes {
+		for _, sd := range cd.Subroutines {
+			for _, ref := range cd.References(sd) {
+				if ref.Kind != RefSubroutine {
+					continue
+				}
+				class := ref.Class
+				if class == "" {
+					class = "?"
+				}
+				callee := class + "." + ref.Token.tokenValue
+				g.addNode(callee, !project[class])
+				g.addEdge(cd.Name+"."+sd.Name, callee)
+			}
+		}
+	}
+	g.cycles = g.findCycles()
+	if _, ok := g.nodes["Main.main"]; ok {
+		reached := g.reachable("Main.main")
+		for _, id := range g.sortedNodes() {
+			if !g.nodes[id] && !reached[id] {
+				g.uncalled = append(g.uncalled, id)
+			}
+		}
+	}
+	return g
+}
+
+// buildClassGraph links every class to the classes it uses, through calls
+// or the types of its variables and subroutines.
+func buildClassGraph(classes []*ClassDecl) *Graph {
+	g := newGraph("classes")
+	project := map[string]bool{}
+	for _, cd := range classes {
+		project[cd.Name] = true
+		g.addNode(cd.Name, false)
+	}
+	use := func(from, to string) {
+		if to == "" || to == from || isPrimitiveType(to) {
+			return
+		}
+		g.addNode(to, !project[to])
+		g.addEdge(from, to)
+	}
+	for _, cd := range classes {
+		for _, v := range cd.Vars {
+			use(cd.Name, v.Type)
+		}
+		for _, sd := range cd.Subroutines {
+			use(cd.Name, sd.ReturnType)
+			for _, v := range append(append([]VarDecl{}, sd.Params...), sd.Locals...) {
+				use(cd.Name, v.Type)
+			}
+			for _, ref := range cd.References(sd) {
+				if ref.Kind == RefSubroutine {
+					use(cd.Name, ref.Class)
+				}
+			}
+		}
+	}
+	g.cycles = g.findCycles()
+	return g
+}
+
+// cycleName names the cycles of the graph: calls recurse, while classes
+// depend on each other.
+func (g *Graph) cycleName() string {
+	if g.Name == "classes" {
+		return "dependency cycle"
+	}
+	return "recursion cycle"
+}
+
+// reachable returns the nodes reachable from start, start included.
+func (g *Graph) reachable(start string) map[string]bool {
+	seen := map[string]bool{start: true}
+	queue := []string{start}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, to := range g.successors(id) {
+			if !seen[to] {
+				seen[to] = true
+				queue = append(queue, to)
+			}
+		}
+	}
+	return seen
+}
+
+// findCycles returns the cycles of the graph: strongly connected components
+// with more than one node, or a node linked to itself (Tarjan). The members
+// of a cycle are listed in the order the edges reach them, from the
+// smallest one.
+func (g *Graph) findCycles() [][]string {
+	index, low := map[string]int{}, map[string]int{}
+	onStack := map[string]bool{}
+	stack := []string{}
+	cycles := [][]string{}
+	next := 0
+	var visit func(id string)
+	visit = func(id string) {
+		index[id], low[id] = next, next
+		next++
+		stack = append(stack, id)
+		onStack[id] = true
+		for _, to := range g.successors(id) {
+			if _, ok := index[to]; !ok {
+				visit(to)
+				low[id] = min(low[id], low[to])
+			} else if onStack[to] {
+				low[id] = min(low[id], index[to])
+			}
+		}
+		if low[id] != index[id] {
+			return
+		}
+		scc := []string{}
+		for {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[top] = false
+			scc = append(scc, top)
+			if top == id {
+				break
+			}
+		}
+		if len(scc) > 1 || g.edges[id][id] > 0 {
+			// the stack holds the members in the order they were reached
+			slices.Reverse(scc)
+			first := slices.Index(scc, slices.Min(scc))
+			cycles = append(cycles, append(scc[first:], scc[:first]...))
+		}
+	}
+	for _, id := range g.sortedNodes() {
+		if _, ok := index[id]; !ok {
+			visit(id)
+		}
+	}
+	return cycles
+}
+
+// inCycle reports whether an edge lies on a cycle.
+func (g *Graph) inCycle(from, to string) bool {
+	for _, cycle := range g.cycles {
+		hasFrom, hasTo := false, false
+		for _, id := range cycle {
+			hasFrom = hasFrom || id == from
+			hasTo = hasTo || id == to
+		}
+		if hasFrom && hasTo {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *Graph) DOT() string {
+	buf := bytes.Buffer{}
+	uncalled := map[string]bool{}
+	for _, id := range g.uncalled {
+		uncalled[id] = true
+	}
+	fmt.Fprintf(&buf, "digraph %s {\n  rankdir=LR;\n  node [shape=ellipse];\n", g.Name)
+	for _, id := range g.sortedNodes() {
+		switch {
+		case g.nodes[id]:
+			fmt.Fprintf(&buf, "  %q [shape=box, color=gray, fontcolor=gray];\n", id)
+		case uncalled[id]:
+			fmt.Fprintf(&buf, "  %q [style=dashed, color=orange];\n", id)
+		default:
+			fmt.Fprintf(&buf, "  %q;\n", id)
+		}
+	}
+	for _, from := range g.sortedNodes() {
+		for _, to := range g.successors(from) {
+			attrs := ""
+			if n := g.edges[from][to]; n > 1 {
+				attrs = fmt.Sprintf("label=\"%d\"", n)
+			}
+			if g.inCycle(from, to) {
+				if attrs != "" {
+					attrs += ", "
+				}
+				attrs += "color=red"
+			}
+			if attrs != "" {
+				attrs = " [" + attrs + "]"
+			}
+			fmt.Fprintf(&buf, "  %q -> %q%s;\n", from, to, attrs)
+		}
+	}
+	fmt.Fprintf(&buf, "}\n")
+	return buf.String()
+}
+
+type graphNodeJSON struct {
+	ID       string `json:"id"`
+	External bool   `json:"external,omitempty"`
+}
+
+type graphEdgeJSON struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Count int    `json:"count"`
+}
+
+type graphJSON struct {
+	Name     string          `json:"name"`
+	Nodes    []graphNodeJSON `json:"nodes"`
+	Edges    []graphEdgeJSON `json:"edges"`
+	Cycles   [][]string      `json:"cycles,omitempty"`
+	Uncalled []string        `json:"uncalled,omitempty"`
+}
+
+func (g *Graph) JSON() string {
+	out := graphJSON{Name: g.Name, Nodes: []graphNodeJSON{}, Edges: []graphEdgeJSON{}, Cycles: g.cycles, Uncalled: g.uncalled}
+	for _, id := range g.sortedNodes() {
+		out.Nodes = append(out.Nodes, graphNodeJSON{ID: id, External: g.nodes[id]})
+		for _, to := range g.successors(id) {
+			out.Edges = append(out.Edges, graphEdgeJSON{From: id, To: to, Count: g.edges[id][to]})
+		}
+	}
+	content, _ := json.MarshalIndent(out, "", "  ")
+	return string(content) + "\n"
+}
+
+// runGraph implements the graph command.
+func runGraph(args []string) {
+	fs := flag.NewFlagSet("graph", flag.ExitOnError)
+	var src, kind, format, out string
+	fs.StringVar(&src, "s", "", "source file in jack extension or a directory with multiple jack files")
+	fs.StringVar(&kind, "kind", "calls", "graph to build: calls (subroutine call graph) or classes (class dependencies)")
+	fs.StringVar(&format, "format", "dot", "output format: dot or json")
+	fs.StringVar(&out, "o", "", "output file (default standard output)")
+	opts := tokenizerFlags(fs)
+	fs.Parse(args)
+	if src == "" {
+		fmt.Println("No source file provided")
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	classes := []*ClassDecl{}
+	for _, sf := range loadProject(src, *opts) {
+		classes = append(classes, declareClass(sf.Tree))
+	}
+	var g *Graph
+	switch kind {
+	case "calls":
+		g = buildCallGraph(classes)
+	case "classes":
+		g = buildClassGraph(classes)
+	default:
+		fmt.Printf("Unknown graph kind %s\n", kind)
+		os.Exit(1)
+	}
+	var content string
+	switch format {
+	case "dot":
+		content = g.DOT()
+	case "json":
+		content = g.JSON()
+	default:
+		fmt.Printf("Unknown graph format %s\n", format)
+		os.Exit(1)
+	}
+	if out == "" {
+		fmt.Print(content)
+	} else if err := os.WriteFile(out, []byte(content), 0644); err != nil {
+		fmt.Printf("Error writing graph file %s: %s\n", out, err)
+		os.Exit(1)
+	}
+
+	// findings go to stderr so that they never mix with the graph
+	for _, cycle := range g.cycles {
+		fmt.Fprintf(os.Stderr, "%s: %s -> %s\n", g.cycleName(), strings.Join(cycle, " -> "), cycle[0])
+	}
+	if kind == "calls" {
+		if _, ok := g.nodes["Main.main"]; !ok {
+			fmt.Fprintln(os.Stderr, "no Main.main entry point, reachability not checked")
+		}
+		for _, id := range g.uncalled {
+			fmt.Fprintf(os.Stderr, "never called from Main.main: %s\n", id)
+		}
+	}
+}
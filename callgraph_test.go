@@ -0,0 +1,53 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGraphCycles(t *testing.T) {
+	_, classes := declareProject(t, `class Main {
+	function void main() {
+		var Tree t;
+		do Main.even(4);
+		do Main.fact(3);
+		do Main.a();
+		let t = Tree.new();
+		return;
+	}
+	function boolean even(int n) { if (n = 0) { return true; } return Main.odd(n - 1); }
+	function boolean odd(int n) { if (n = 0) { return false; } return Main.even(n - 1); }
+	function int fact(int n) { if (n = 0) { return 1; } return n * Main.fact(n - 1); }
+	function void a() { do Main.c(); return; }
+	function void b() { do Main.a(); return; }
+	function void c() { do Main.b(); return; }
+	function void unused() { do Output.printInt(1); return; }
+}`, `class Tree {
+	field Node root;
+	constructor Tree new() { let root = Node.new(this); return this; }
+}`, `class Node {
+	field Tree owner;
+	constructor Node new(Tree t) { let owner = t; return this; }
+}`)
+
+	tests := []struct {
+		graph    *Graph
+		cycles   [][]string
+		name     string
+		uncalled []string
+	}{
+		{buildCallGraph(classes), [][]string{{"Main.a", "Main.c", "Main.b"}, {"Main.even", "Main.odd"}, {"Main.fact"}}, "recursion cycle", []string{"Main.unused"}},
+		{buildClassGraph(classes), [][]string{{"Node", "Tree"}}, "dependency cycle", nil},
+	}
+	for _, tt := range tests {
+		if !reflect.DeepEqual(tt.graph.cycles, tt.cycles) {
+			t.Errorf("%s: cycles %v, want %v", tt.graph.Name, tt.graph.cycles, tt.cycles)
+		}
+		if got := tt.graph.cycleName(); got != tt.name {
+			t.Errorf("%s: cycle name %q, want %q", tt.graph.Name, got, tt.name)
+		}
+		if !reflect.DeepEqual(tt.graph.uncalled, tt.uncalled) {
+			t.Errorf("%s: uncalled %v, want %v", tt.graph.Name, tt.graph.uncalled, tt.uncalled)
+		}
+	}
+}
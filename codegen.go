@@ -0,0 +1,374 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// VMCommand is a single command of the Hack virtual machine language.
+type VMCommand struct {
+	Op    string // push, pop, an arithmetic command, label, goto, if-goto, function, call or return
+	Arg   string // segment, label or function name
+	Index int    // segment index, local variable count or argument count
+}
+
+func (c VMCommand) String() string {
+	switch c.Op {
+	case "push", "pop", "function", "call":
+		return fmt.Sprintf("%s %s %d", c.Op, c.Arg, c.Index)
+	case "label", "goto", "if-goto":
+		return c.Op + " " + c.Arg
+	}
+	return c.Op
+}
+
+// vmText renders a command list as the contents of a .vm file.
+func vmText(code []VMCommand) string {
+	var sb strings.Builder
+	for _, c := range code {
+		sb.WriteString(c.String())
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// vmBinaryOps translates the binary operators; * and / are OS calls.
+var vmBinaryOps = map[string]VMCommand{
+	SymPLUS:      {Op: "add"},
+	SymMINUS:     {Op: "sub"},
+	SymSTAR:      {Op: "call", Arg: "Math.multiply", Index: 2},
+	SymSLASH:     {Op: "call", Arg: "Math.divide", Index: 2},
+	SymAMPERSAND: {Op: "and"},
+	SymPIPE:      {Op: "or"},
+	SymLT:        {Op: "lt"},
+	SymGT:        {Op: "gt"},
+	SymEQ:        {Op: "eq"},
+}
+
+// vmSegments maps variable kinds to the VM memory segments holding them.
+var vmSegments = map[string]string{
+	KwSTATIC:   "static",
+	KwFIELD:    "this",
+	"argument": "argument",
+	KwVAR:      "local",
+}
+
+// codeGenerator compiles the parse tree of a class to VM code.
+type codeGenerator struct {
+	cd       *ClassDecl
+	sd       *SubroutineDecl
+	optimize bool
+	table    PrecedenceTable
+	code     []VMCommand
+	ifs      int // label counters, per subroutine
+	whiles   int
+	err      error // first error met
+}
+
+// compileClass generates the VM code of a class. With optimize set,
+// constant expressions are folded, dead branches dropped and the command
+// stream goes through the peephole optimizer.
+func compileClass(cd *ClassDecl, optimize bool) ([]VMCommand, error) {
+	table, _ := parsePrecedence(jackPrecedence)
+	g := &codeGenerator{cd: cd, optimize: optimize, table: table}
+	for _, sd := range cd.Subroutines {
+		g.subroutine(sd)
+	}
+	if g.err != nil {
+		return nil, g.err
+	}
+	if optimize {
+		return peephole(g.code), nil
+	}
+	return g.code, nil
+}
+
+func (g *codeGenerator) emit(op, arg string, index int) {
+	g.code = append(g.code, VMCommand{Op: op, Arg: arg, Index: index})
+}
+
+func (g *codeGenerator) fail(token Token, msg string, args ...any) {
+	if g.err == nil {
+		g.err = NewTokenErr(token, msg, args...)
+	}
+}
+
+func (g *codeGenerator) subroutine(sd *SubroutineDecl) {
+	g.sd, g.ifs, g.whiles = sd, 0, 0
+	g.emit("function", g.cd.Name+"."+sd.Name, len(sd.Locals))
+	switch sd.Kind {
+	case KwCONSTRUCTOR:
+		fields := 0
+		for _, v := range g.cd.Vars {
+			if v.Kind == KwFIELD {
+				fields++
+			}
+		}
+		g.emit("push", "constant", fields)
+		g.emit("call", "Memory.alloc", 1)
+		g.emit("pop", "pointer", 0)
+	case KwMETHOD:
+		g.emit("push", "argument", 0)
+		g.emit("pop", "pointer", 0)
+	}
+	g.statements(sd.Body.Child("statements"))
+}
+
+func (g *codeGenerator) statements(node *Node) {
+	for _, st := range node.children {
+		switch st.kind {
+		case "letStatement":
+			g.letStatement(st)
+		case "ifStatement":
+			g.ifStatement(st)
+		case "whileStatement":
+			g.whileStatement(st)
+		case "doStatement":
+			g.doStatement(st)
+		case "returnStatement":
+			g.returnStatement(st)
+		}
+	}
+}
+
+func (g *codeGenerator) letStatement(node *Node) {
+	name := *node.children[1].token
+	exprs := node.ChildrenOf("expression")
+	if len(exprs) == 1 {
+		g.expression(exprs[0])
+		g.popVar(name)
+		return
+	}
+	// name[index] = value; the value is parked in temp 0 while THAT is set
+	g.pushVar(name)
+	g.expression(exprs[0])
+	g.emit("add", "", 0)
+	g.expression(exprs[1])
+	g.emit("pop", "temp", 0)
+	g.emit("pop", "pointer", 1)
+	g.emit("push", "temp", 0)
+	g.emit("pop", "that", 0)
+}
+
+func (g *codeGenerator) ifStatement(node *Node) {
+	cond := g.exprTree(node.Child("expression"))
+	blocks := node.ChildrenOf("statements")
+	if value, ok := constValue(cond); ok && g.optimize {
+		if value != 0 {
+			g.statements(blocks[0])
+		} else if len(blocks) > 1 {
+			g.statements(blocks[1])
+		}
+		return
+	}
+	n := strconv.Itoa(g.ifs)
+	g.ifs++
+	g.exprCode(cond)
+	g.emit("not", "", 0)
+	g.emit("if-goto", "IF_FALSE"+n, 0)
+	g.statements(blocks[0])
+	if len(blocks) == 1 {
+		g.emit("label", "IF_FALSE"+n, 0)
+		return
+	}
+	g.emit("goto", "IF_END"+n, 0)
+	g.emit("label", "IF_FALSE"+n, 0)
+	g.statements(blocks[1])
+	g.emit("label", "IF_END"+n, 0)
+}
+
+func (g *codeGenerator) whileStatement(node *Node) {
+	cond := g.exprTree(node.Child("expression"))
+	if value, ok := constValue(cond); ok && g.optimize && value == 0 {
+		return
+	}
+	n := strconv.Itoa(g.whiles)
+	g.whiles++
+	g.emit("label", "WHILE_EXP"+n, 0)
+	g.exprCode(cond)
+	g.emit("not", "", 0)
+	g.emit("if-goto", "WHILE_END"+n, 0)
+	g.statements(node.Child("statements"))
+	g.emit("goto", "WHILE_EXP"+n, 0)
+	g.emit("label", "WHILE_END"+n, 0)
+}
+
+func (g *codeGenerator) doStatement(node *Node) {
+	tokens := node.ChildTokens()
+	call := &ExprTree{Kind: "call", Value: tokens[1].tokenValue, token: tokens[1]}
+	if tokens[2].Is(SYMBOL, SymDOT) {
+		call.Value += "." + tokens[3].tokenValue
+	}
+	for _, arg := range node.Child("expressionList").ChildrenOf("expression") {
+		call.Args = append(call.Args, g.exprTree(arg))
+	}
+	g.exprCode(call)
+	g.emit("pop", "temp", 0)
+}
+
+func (g *codeGenerator) returnStatement(node *Node) {
+	if expr := node.Child("expression"); expr != nil {
+		g.expression(expr)
+	} else {
+		g.emit("push", "constant", 0)
+	}
+	g.emit("return", "", 0)
+}
+
+// exprTree rebuilds an expression node with Jack's left-to-right
+// evaluation, folded when optimizing.
+func (g *codeGenerator) exprTree(node *Node) *ExprTree {
+	et := buildExprTree(node, g.table)
+	if g.optimize {
+		et = fold(et)
+	}
+	return et
+}
+
+func (g *codeGenerator) expression(node *Node) {
+	g.exprCode(g.exprTree(node))
+}
+
+func (g *codeGenerator) exprCode(et *ExprTree) {
+	switch et.Kind {
+	case "binary":
+		g.exprCode(et.Left)
+		g.exprCode(et.Right)
+		op := vmBinaryOps[et.Op]
+		g.emit(op.Op, op.Arg, op.Index)
+	case "unary":
+		g.exprCode(et.Operand)
+		if et.Op == SymMINUS {
+			g.emit("neg", "", 0)
+		} else {
+			g.emit("not", "", 0)
+		}
+	case "int":
+		n, _ := strconv.Atoi(et.Value)
+		g.constant(n)
+	case "string":
+		runes := []rune(et.Value)
+		g.emit("push", "constant", len(runes))
+		g.emit("call", "String.new", 1)
+		for _, r := range runes {
+			if r == '\n' {
+				r = 128 // String.newLine()
+			}
+			g.emit("push", "constant", int(r))
+			g.emit("call", "String.appendChar", 2)
+		}
+	case "keyword":
+		switch et.Value {
+		case KwTRUE:
+			g.constant(-1)
+		case KwTHIS:
+			g.emit("push", "pointer", 0)
+		default: // false and null
+			g.emit("push", "constant", 0)
+		}
+	case "var":
+		g.pushVar(et.token)
+	case "index":
+		g.pushVar(et.token)
+		g.exprCode(et.Operand)
+		g.emit("add", "", 0)
+		g.emit("pop", "pointer", 1)
+		g.emit("push", "that", 0)
+	case "call":
+		g.call(et)
+	}
+}
+
+// constant pushes a 16-bit value; the VM only has non-negative constants.
+func (g *codeGenerator) constant(n int) {
+	switch {
+	case n >= 0:
+		g.emit("push", "constant", n)
+	case n == -1:
+		g.emit("push", "constant", 0)
+		g.emit("not", "", 0)
+	case n == -32768:
+		g.emit("push", "constant", 32767)
+		g.emit("not", "", 0)
+	default:
+		g.emit("push", "constant", -n)
+		g.emit("neg", "", 0)
+	}
+}
+
+// call compiles a subroutine call. Calls through a variable and unqualified
+// calls of methods pass the receiver as argument 0.
+func (g *codeGenerator) call(et *ExprTree) {
+	receiver, name, qualified := strings.Cut(et.Value, ".")
+	class, args := g.cd.Name, len(et.Args)
+	switch {
+	case !qualified:
+		name = receiver
+		if sd := g.cd.Subroutine(name); sd == nil || sd.Kind == KwMETHOD {
+			g.emit("push", "pointer", 0)
+			args++
+		}
+	case g.cd.Lookup(g.sd, receiver) != nil:
+		v := g.cd.Lookup(g.sd, receiver)
+		if isPrimitiveType(v.Type) {
+			g.fail(et.token, "cannot call %s on %s of type %s", name, receiver, v.Type)
+			return
+		}
+		g.pushVar(et.token)
+		class = v.Type
+		args++
+	default:
+		class = receiver
+	}
+	for _, arg := range et.Args {
+		g.exprCode(arg)
+	}
+	g.emit("call", class+"."+name, args)
+}
+
+func (g *codeGenerator) pushVar(name Token) {
+	if segment, index, ok := g.variable(name); ok {
+		g.emit("push", segment, index)
+	}
+}
+
+func (g *codeGenerator) popVar(name Token) {
+	if segment, index, ok := g.variable(name); ok {
+		g.emit("pop", segment, index)
+	}
+}
+
+// variable resolves a variable to its segment and index: fields and statics
+// count in declaration order per kind, method arguments start at 1.
+func (g *codeGenerator) variable(name Token) (string, int, bool) {
+	v := g.cd.Lookup(g.sd, name.tokenValue)
+	if v == nil {
+		g.fail(name, "undeclared variable %s", name.tokenValue)
+		return "", 0, false
+	}
+	if g.sd.Kind == KwFUNCTION && v.Kind == KwFIELD {
+		g.fail(name, "field %s used in function %s", v.Name, g.sd.Name)
+		return "", 0, false
+	}
+	scope := g.cd.Vars
+	switch v.Kind {
+	case "argument":
+		scope = g.sd.Params
+	case KwVAR:
+		scope = g.sd.Locals
+	}
+	index := 0
+	for i := range scope {
+		if &scope[i] == v {
+			break
+		}
+		if scope[i].Kind == v.Kind {
+			index++
+		}
+	}
+	if v.Kind == "argument" && g.sd.Kind == KwMETHOD {
+		index++
+	}
+	return vmSegments[v.Kind], index, true
+}
@@ -1,47 +1,197 @@
 package main
 
 import (
-	"bytes"
-	"fmt"
 	"slices"
+	"strings"
 )
 
+// TokenSource is the token stream read by the CompilationEngine; the
+// Tokenizer is the usual implementation.
+type TokenSource interface {
+	Reset()
+	Advance() (*Token, error)
+	Peek(n int) (Token, bool)
+	Mark() int
+	Rewind(mark int)
+}
+
 type CompilationEngine struct {
-	buffer       *bytes.Buffer
-	tokenizer    *Tokenizer
-	currentToken Token
+	out          *XMLWriter
+	tokenizer    TokenSource
+	currentToken *Token
+	tree         *Node
+	openNodes    []*Node
+	depth        int                // nesting of terms and statement blocks
+	lastEnd      int                // source offset past the last token consumed
+	coverage     map[grammarAlt]int // grammar alternatives taken, when tracked
+	arena        nodeArena
 }
 
-func NewCompilationEngine(tokenizer *Tokenizer, buffer *bytes.Buffer) *CompilationEngine {
-	ce := &CompilationEngine{tokenizer: tokenizer, buffer: buffer}
+// maxNesting bounds the recursion of terms and statement blocks, so that
+// hostile input yields a diagnostic instead of exhausting the stack.
+const maxNesting = 1000
+
+// NewCompilationEngine reads tokens from tokenizer and writes the XML parse
+// tree to out, which may be nil when only the tree is wanted.
+func NewCompilationEngine(tokenizer TokenSource, out *XMLWriter) *CompilationEngine {
+	ce := &CompilationEngine{tokenizer: tokenizer, out: out}
 	tokenizer.Reset()
 	ce.advance()
 	return ce
 }
 
-func (ce *CompilationEngine) print(s string) error {
-	_, err := ce.buffer.WriteString(s)
-	return err
+func (ce *CompilationEngine) printOpenTag(s string) error {
+	node := ce.arena.newRuleNode(s)
+	node.start, node.end = ce.currentToken.offset, ce.currentToken.offset
+	if n := len(ce.openNodes); n > 0 {
+		ce.openNodes[n-1].add(node)
+	} else {
+		ce.tree = node
+	}
+	ce.openNodes = append(ce.openNodes, node)
+	if ce.out == nil {
+		return nil
+	}
+	ce.out.Open(s)
+	return ce.out.Err()
 }
-func (ce *CompilationEngine) printOpenTag(s string) error  { return ce.print(fmt.Sprintf("<%s>", s)) }
-func (ce *CompilationEngine) printCloseTag(s string) error { return ce.print(fmt.Sprintf("</%s>", s)) }
 
-func (ce *CompilationEngine) advance() (Token, error) {
-	token, err := ce.tokenizer.Advance()
-	if err != nil {
-		return Token{}, err
+func (ce *CompilationEngine) printCloseTag(s string) error {
+	node := ce.openNodes[len(ce.openNodes)-1]
+	node.end = max(node.start, ce.lastEnd)
+	ce.openNodes = ce.openNodes[:len(ce.openNodes)-1]
+	if ce.out == nil {
+		return nil
 	}
-	ce.currentToken = token
-	return token, nil
+	ce.out.Close(s)
+	return ce.out.Err()
+}
+
+func (ce *CompilationEngine) printToken(token *Token) error {
+	if n := len(ce.openNodes); n > 0 {
+		ce.openNodes[n-1].add(ce.arena.newTokenNode(token))
+	}
+	ce.lastEnd = token.offset + len(token.lexeme)
+	if ce.out == nil {
+		return nil
+	}
+	ce.out.Element(string(token.tokenType), token.tokenValue)
+	return ce.out.Err()
+}
+
+// cover records a grammar alternative taken by the parser when coverage is
+// tracked.
+func (ce *CompilationEngine) cover(rule, alt string) {
+	if ce.coverage != nil {
+		ce.coverage[grammarAlt{rule, alt}]++
+	}
+}
+
+// coverRepeat records whether a comma-separated list goes on after its first
+// item.
+func (ce *CompilationEngine) coverRepeat(rule string) {
+	if ce.currentToken.Is(SYMBOL, SymCOMMA) {
+		ce.cover(rule, "several")
+	} else {
+		ce.cover(rule, "one")
+	}
+}
+
+// Tree returns the parse tree built so far; after a successful ProcessClass
+// it is the complete class.
+func (ce *CompilationEngine) Tree() *Node { return ce.tree }
+
+// ParseExpression parses the token source as a single expression.
+func (ce *CompilationEngine) ParseExpression() (*Node, error) {
+	return ce.parseFragment(ce.processExpression)
+}
+
+// ParseStatements parses the token source as a statement list.
+func (ce *CompilationEngine) ParseStatements() (*Node, error) {
+	return ce.parseFragment(ce.processStatements)
+}
+
+// ParseSubroutineDec parses the token source as a subroutine declaration.
+func (ce *CompilationEngine) ParseSubroutineDec() (*Node, error) {
+	if err := ce.expectKeyword(KwCONSTRUCTOR, KwFUNCTION, KwMETHOD); err != nil {
+		return nil, err
+	}
+	return ce.parseFragment(ce.processSubroutine)
+}
+
+// ParseClassVarDec parses the token source as a static or field declaration.
+func (ce *CompilationEngine) ParseClassVarDec() (*Node, error) {
+	if err := ce.expectKeyword(KwSTATIC, KwFIELD); err != nil {
+		return nil, err
+	}
+	return ce.parseFragment(ce.processClassVar)
+}
+
+// ParseVarDec parses the token source as a local variable declaration.
+func (ce *CompilationEngine) ParseVarDec() (*Node, error) {
+	return ce.parseFragment(ce.processVarDec)
+}
+
+// expectKeyword checks the keyword a fragment starts with, which the rules
+// leave to the class body that dispatches to them.
+func (ce *CompilationEngine) expectKeyword(kws ...string) error {
+	if ct := ce.currentToken; !ct.IsMulti(KEYWORD, kws...) {
+		return NewTokenErr(*ct, "expected keyword %s, got %s %s", strings.Join(kws, "|"), ct.tokenType, ct.tokenValue)
+	}
+	return nil
+}
+
+// parseFragment runs a single grammar rule and checks that it consumed the
+// whole token source.
+func (ce *CompilationEngine) parseFragment(rule func() error) (*Node, error) {
+	if err := rule(); err != nil {
+		return nil, err
+	}
+	if ct := ce.currentToken; !ct.Is(EOF, "") {
+		return nil, NewTokenErr(*ct, "unexpected %s %s after the end of the %s", ct.tokenType, ct.tokenValue, ce.tree.kind)
+	}
+	return ce.tree, nil
+}
+
+// advance moves to the next token; past the end of input currentToken
+// becomes the EOF token so that the next process call reports it.
+func (ce *CompilationEngine) advance() {
+	ce.currentToken, _ = ce.tokenizer.Advance()
+}
+
+// peek looks n tokens past currentToken without consuming anything.
+func (ce *CompilationEngine) peek(n int) Token {
+	token, _ := ce.tokenizer.Peek(n)
+	return token
 }
 
 func (ce *CompilationEngine) process(tok TokenType, val string) error {
 	ct := ce.currentToken
-	if ct.tokenType != tok || (val != "" && ct.UnescapedValue() != val) {
-		return NewTokenErr(ct, "expected %s %s , got %s %s", tok, val, ct.tokenType, ct.UnescapedValue())
+	if ct.tokenType != tok || (val != "" && ct.tokenValue != val) {
+		if name := ce.hyphenatedName(); name != "" {
+			return NewTokenErr(*ct, "identifier %s cannot contain '-'", name)
+		}
+		return NewTokenErr(*ct, "expected %s %s , got %s %s", tok, val, ct.tokenType, ct.tokenValue)
 	}
 	ce.advance()
-	return ce.print(ct.Tag())
+	return ce.printToken(ct)
+}
+
+// hyphenatedName recognizes a current '-' glued between an identifier and
+// another word, as in `var int my-var;`. It is only consulted once the
+// grammar has rejected the '-', so subtractions such as x-1 are unaffected.
+func (ce *CompilationEngine) hyphenatedName() string {
+	prev, ct, next := ce.peek(-1), ce.currentToken, ce.peek(1)
+	if !ct.Is(SYMBOL, SymMINUS) || !prev.Is(IDENTIFIER, "") ||
+		!(next.Is(IDENTIFIER, "") || next.Is(KEYWORD, "") || next.Is(INT_CONST, "")) {
+		return ""
+	}
+	glued := prev.lineNum == ct.lineNum && ct.lineNum == next.lineNum &&
+		prev.colNum+len(prev.tokenValue) == ct.colNum && ct.colNum+1 == next.colNum
+	if !glued {
+		return ""
+	}
+	return prev.tokenValue + SymMINUS + next.tokenValue
 }
 
 func (ce *CompilationEngine) ProcessClass() error {
@@ -80,6 +230,7 @@ func (ce *CompilationEngine) ProcessClass() error {
 
 func (ce *CompilationEngine) processClassVar() error {
 	ce.printOpenTag("classVarDec")
+	ce.cover("classVarDec", ce.currentToken.tokenValue)
 	// print field or static
 	if err := ce.process(KEYWORD, ""); err != nil {
 		return err
@@ -93,6 +244,7 @@ func (ce *CompilationEngine) processClassVar() error {
 		return err
 	}
 	// process multiple varName
+	ce.coverRepeat("classVarDec")
 	for ce.currentToken.Is(SYMBOL, SymCOMMA) {
 		if err := ce.process(SYMBOL, SymCOMMA); err != nil {
 			return err
@@ -110,16 +262,19 @@ func (ce *CompilationEngine) processClassVar() error {
 
 func (ce *CompilationEngine) processType() error {
 	ct := ce.currentToken
-	val := ct.UnescapedValue()
+	val := ct.tokenValue
 	isType := ct.tokenType == KEYWORD && (val == KwINT || val == KwCHAR || val == KwBOOLEAN || val == KwVOID)
 	if isType {
+		ce.cover("type", val)
 		return ce.process(KEYWORD, "")
 	}
+	ce.cover("type", "className")
 	return ce.process(IDENTIFIER, "")
 }
 
 func (ce *CompilationEngine) processSubroutine() error {
 	ce.printOpenTag("subroutineDec")
+	ce.cover("subroutineDec", ce.currentToken.tokenValue)
 	// print function keyword (method, function, constructor)
 	if err := ce.process(KEYWORD, ""); err != nil {
 		return err
@@ -155,7 +310,9 @@ func (ce *CompilationEngine) processSubroutine() error {
 
 func (ce *CompilationEngine) processParameterList() error {
 	ce.printOpenTag("parameterList")
-	if !ce.currentToken.Is(SYMBOL, SymRPAREN) {
+	if ce.currentToken.Is(SYMBOL, SymRPAREN) {
+		ce.cover("parameterList", "empty")
+	} else {
 		// print type
 		if err := ce.processType(); err != nil {
 			return err
@@ -165,6 +322,7 @@ func (ce *CompilationEngine) processParameterList() error {
 			return err
 		}
 		// process multiple varName
+		ce.coverRepeat("parameterList")
 		for ce.currentToken.Is(SYMBOL, SymCOMMA) {
 			// print ,
 			if err := ce.process(SYMBOL, SymCOMMA); err != nil {
@@ -191,6 +349,11 @@ func (ce *CompilationEngine) processSubroutineBody() error {
 		return err
 	}
 	// process multiple varDec
+	if ce.currentToken.Is(KEYWORD, KwVAR) {
+		ce.cover("subroutineBody", "with varDec")
+	} else {
+		ce.cover("subroutineBody", "without varDec")
+	}
 	for ce.currentToken.Is(KEYWORD, KwVAR) {
 		if err := ce.processVarDec(); err != nil {
 			return err
@@ -223,6 +386,7 @@ func (ce *CompilationEngine) processVarDec() error {
 		return err
 	}
 	// process multiple varName
+	ce.coverRepeat("varDec")
 	for ce.currentToken.Is(SYMBOL, SymCOMMA) {
 		if err := ce.process(SYMBOL, SymCOMMA); err != nil {
 			return err
@@ -239,11 +403,28 @@ func (ce *CompilationEngine) processVarDec() error {
 	return nil
 }
 
+// nest enters a level of recursion; the caller defers the decrement.
+func (ce *CompilationEngine) nest() error {
+	ce.depth++
+	if ce.depth > maxNesting {
+		return NewTokenErr(*ce.currentToken, "nesting deeper than %d levels", maxNesting)
+	}
+	return nil
+}
+
 func (ce *CompilationEngine) processStatements() error {
+	defer func() { ce.depth-- }()
+	if err := ce.nest(); err != nil {
+		return err
+	}
 	ce.printOpenTag("statements")
+	if !ce.currentToken.IsMulti(KEYWORD, KwLET, KwDO, KwIF, KwWHILE, KwRETURN) {
+		ce.cover("statements", "empty")
+	}
 	for ce.currentToken.IsMulti(KEYWORD, KwLET, KwDO, KwIF, KwWHILE, KwRETURN) {
 		var err error
-		switch ce.currentToken.UnescapedValue() {
+		ce.cover("statement", ce.currentToken.tokenValue)
+		switch ce.currentToken.tokenValue {
 		case KwLET:
 			err = ce.processLetStm()
 		case KwDO:
@@ -255,7 +436,7 @@ func (ce *CompilationEngine) processStatements() error {
 		case KwWHILE:
 			err = ce.processWhileStm()
 		default:
-			return NewTokenErr(ce.currentToken, "unknown statement: %s", ce.currentToken.Tag())
+			return NewTokenErr(*ce.currentToken, "unknown statement: %s", ce.currentToken.Tag())
 		}
 		if err != nil {
 			return err
@@ -275,8 +456,11 @@ func (ce *CompilationEngine) processLetStm() error {
 	if err := ce.process(IDENTIFIER, ""); err != nil {
 		return err
 	}
-	// print [
-	if ce.currentToken.Is(SYMBOL, SymLSQBR) {
+	// print [ expression ] of an array element
+	if !ce.currentToken.Is(SYMBOL, SymLSQBR) {
+		ce.cover("letStatement", "varName")
+	} else {
+		ce.cover("letStatement", "varName[expression]")
 		// print [
 		if err := ce.process(SYMBOL, SymLSQBR); err != nil {
 			return err
@@ -312,10 +496,7 @@ func (ce *CompilationEngine) processDoStm() error {
 	if err := ce.process(KEYWORD, KwDO); err != nil {
 		return err
 	}
-	// print identifier || do game.run(); / do draw();
-	if err := ce.process(IDENTIFIER, ""); err != nil {
-		return err
-	}
+	// print subroutine call || do game.run(); / do draw();
 	if err := ce.processSubroutineCall(); err != nil {
 		return err
 	}
@@ -327,8 +508,20 @@ func (ce *CompilationEngine) processDoStm() error {
 	return nil
 }
 
+// processSubroutineCall handles subroutineName '(' expressionList ')' and
+// (className | varName) '.' subroutineName '(' expressionList ')'.
 func (ce *CompilationEngine) processSubroutineCall() error {
-	if ce.currentToken.Is(SYMBOL, SymDOT) {
+	isQualified := ce.peek(1).Is(SYMBOL, SymDOT)
+	if isQualified {
+		ce.cover("subroutineCall", "name.subroutineName(expressionList)")
+	} else {
+		ce.cover("subroutineCall", "subroutineName(expressionList)")
+	}
+	// print subroutineName, className or varName
+	if err := ce.process(IDENTIFIER, ""); err != nil {
+		return err
+	}
+	if isQualified {
 		// print .
 		if err := ce.process(SYMBOL, SymDOT); err != nil {
 			return err
@@ -359,7 +552,10 @@ func (ce *CompilationEngine) processReturnStm() error {
 	if err := ce.process(KEYWORD, KwRETURN); err != nil {
 		return err
 	}
-	if !ce.currentToken.Is(SYMBOL, SymSEMICOLON) {
+	if ce.currentToken.Is(SYMBOL, SymSEMICOLON) {
+		ce.cover("returnStatement", "without value")
+	} else {
+		ce.cover("returnStatement", "with value")
 		// print expression
 		if err := ce.processExpression(); err != nil {
 			return err
@@ -403,7 +599,10 @@ func (ce *CompilationEngine) processIfStm() error {
 	if err := ce.process(SYMBOL, SymRBRACE); err != nil {
 		return err
 	}
-	if ce.currentToken.Is(KEYWORD, KwELSE) {
+	if !ce.currentToken.Is(KEYWORD, KwELSE) {
+		ce.cover("ifStatement", "without else")
+	} else {
+		ce.cover("ifStatement", "with else")
 		// print else keyword
 		if err := ce.process(KEYWORD, KwELSE); err != nil {
 			return err
@@ -464,14 +663,14 @@ func (ce *CompilationEngine) processExpression() error {
 	// check if it is a token
 	ct := ce.currentToken
 
-	isKeyboardConstant := ct.tokenType == KEYWORD && slices.Contains(keyboardConstants, ct.UnescapedValue())
+	isKeyboardConstant := ct.tokenType == KEYWORD && slices.Contains(keyboardConstants, ct.tokenValue)
 	isUnaryOp := ct.Is(SYMBOL, SymTILDE) || ct.Is(SYMBOL, SymMINUS)
 	isVarName := ct.Is(IDENTIFIER, "")
 	isValidTerm := ct.tokenType == INT_CONST || ct.tokenType == STRING_CONST ||
 		isKeyboardConstant || isVarName || isUnaryOp || ct.Is(SYMBOL, SymLPAREN)
 
 	if !isValidTerm {
-		return NewTokenErr(ct, "expected term, got %s", ct.Tag())
+		return NewTokenErr(*ct, "expected term, got %s", ct.Tag())
 	}
 
 	ce.printOpenTag("expression")
@@ -482,7 +681,13 @@ func (ce *CompilationEngine) processExpression() error {
 	}
 
 	// process the rest of the terms
-	for slices.Contains(opList, ce.currentToken.UnescapedValue()) {
+	if !slices.Contains(opList, ce.currentToken.tokenValue) {
+		ce.cover("expression", "term")
+	} else {
+		ce.cover("expression", "term op term")
+	}
+	for slices.Contains(opList, ce.currentToken.tokenValue) {
+		ce.cover("op", ce.currentToken.tokenValue)
 		if err := ce.process(SYMBOL, ""); err != nil {
 			return err
 		}
@@ -496,21 +701,28 @@ func (ce *CompilationEngine) processExpression() error {
 }
 
 func (ce *CompilationEngine) processTerm() error {
+	defer func() { ce.depth-- }()
+	if err := ce.nest(); err != nil {
+		return err
+	}
 	ce.printOpenTag("term")
 
 	ct := ce.currentToken
 	isKeyboardConstant := ct.tokenType == KEYWORD &&
-		slices.Contains(keyboardConstants, ct.UnescapedValue())
+		slices.Contains(keyboardConstants, ct.tokenValue)
 
 	if ct.tokenType == INT_CONST || ct.tokenType == STRING_CONST || isKeyboardConstant {
-		ct := ce.currentToken
-		if _, err := ce.advance(); err != nil {
-			return err
+		if isKeyboardConstant {
+			ce.cover("term", "keywordConstant")
+			ce.cover("keywordConstant", ct.tokenValue)
+		} else {
+			ce.cover("term", string(ct.tokenType))
 		}
-		if err := ce.print(ct.Tag()); err != nil {
+		if err := ce.process(ct.tokenType, ""); err != nil {
 			return err
 		}
 	} else if ct.Is(SYMBOL, SymLPAREN) {
+		ce.cover("term", "(expression)")
 		if err := ce.process(SYMBOL, SymLPAREN); err != nil {
 			return err
 		}
@@ -522,18 +734,24 @@ func (ce *CompilationEngine) processTerm() error {
 		}
 	} else if ct.Is(SYMBOL, SymMINUS) || ct.Is(SYMBOL, SymTILDE) {
 		// unary processing
+		ce.cover("term", "unaryOp term")
+		ce.cover("unaryOp", ct.tokenValue)
 		if err := ce.process(SYMBOL, ""); err != nil {
 			return err
 		}
 		if err := ce.processTerm(); err != nil {
 			return err
 		}
-	} else if ct.Is(IDENTIFIER, "") { // check var name
-		if err := ce.process(IDENTIFIER, ""); err != nil {
-			return err
-		}
-		if ce.currentToken.Is(SYMBOL, SymLSQBR) {
+	} else if ct.Is(IDENTIFIER, "") {
+		// decide between foo[, foo(, foo. and a plain var name before
+		// consuming the identifier
+		next := ce.peek(1)
+		if next.Is(SYMBOL, SymLSQBR) {
 			// array processing
+			ce.cover("term", "varName[expression]")
+			if err := ce.process(IDENTIFIER, ""); err != nil {
+				return err
+			}
 			if err := ce.process(SYMBOL, SymLSQBR); err != nil {
 				return err
 			}
@@ -543,14 +761,20 @@ func (ce *CompilationEngine) processTerm() error {
 			if err := ce.process(SYMBOL, SymRSQBR); err != nil {
 				return err
 			}
-		} else if ce.currentToken.Is(SYMBOL, SymLPAREN) || ce.currentToken.Is(SYMBOL, SymDOT) {
+		} else if next.Is(SYMBOL, SymLPAREN) || next.Is(SYMBOL, SymDOT) {
 			// function calls processing or object processing
+			ce.cover("term", "subroutineCall")
 			if err := ce.processSubroutineCall(); err != nil {
 				return err
 			}
+		} else {
+			ce.cover("term", "varName")
+			if err := ce.process(IDENTIFIER, ""); err != nil {
+				return err
+			}
 		}
 	} else {
-		return NewTokenErr(ct, "expected array, function call, or object, got %s", ct.Tag())
+		return NewTokenErr(*ct, "expected array, function call, or object, got %s", ct.Tag())
 	}
 
 	ce.printCloseTag("term")
@@ -559,10 +783,13 @@ func (ce *CompilationEngine) processTerm() error {
 
 func (ce *CompilationEngine) processExpressionList() error {
 	ce.printOpenTag("expressionList")
-	if !ce.currentToken.Is(SYMBOL, SymRPAREN) {
+	if ce.currentToken.Is(SYMBOL, SymRPAREN) {
+		ce.cover("expressionList", "empty")
+	} else {
 		if err := ce.processExpression(); err != nil {
 			return err
 		}
+		ce.coverRepeat("expressionList")
 		for ce.currentToken.Is(SYMBOL, SymCOMMA) {
 			if err := ce.process(SYMBOL, SymCOMMA); err != nil {
 				return err
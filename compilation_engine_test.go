@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestTokenizerMarkRewind(t *testing.T) {
+	tokenizer, err := NewTokenizer("x[1]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokenizer.Advance()
+	m := tokenizer.Mark()
+	for range 4 {
+		tokenizer.Advance()
+	}
+	if tok, ok := tokenizer.Peek(0); ok || !tok.Is(EOF, "") {
+		t.Fatalf("Peek(0) past the end = %s, %v, want EOF", tok.Tag(), ok)
+	}
+	tokenizer.Rewind(m)
+	if tok, _ := tokenizer.Peek(0); !tok.Is(IDENTIFIER, "x") {
+		t.Fatalf("Peek(0) after Rewind = %s, want x", tok.Tag())
+	}
+	if tok, _ := tokenizer.Advance(); !tok.Is(SYMBOL, SymLSQBR) {
+		t.Fatalf("Advance after Rewind = %s, want [", tok.Tag())
+	}
+}
+
+// treeXML renders a parse tree the way the analyzer writes it.
+func treeXML(n *Node) string {
+	var buf bytes.Buffer
+	n.WriteXML(NewXMLWriter(&buf, "  ", "\n"))
+	return buf.String()
+}
+
+func TestParseFragments(t *testing.T) {
+	entries := map[string]func(*CompilationEngine) (*Node, error){
+		"expression":    (*CompilationEngine).ParseExpression,
+		"statements":    (*CompilationEngine).ParseStatements,
+		"subroutineDec": (*CompilationEngine).ParseSubroutineDec,
+		"classVarDec":   (*CompilationEngine).ParseClassVarDec,
+		"varDec":        (*CompilationEngine).ParseVarDec,
+	}
+	tests := []struct {
+		rule string
+		src  string
+		want string // XML of the tree, or the error
+	}{
+		{"statements", "let x = 1; return;", `<statements>
+  <letStatement>
+    <keyword> let </keyword>
+    <identifier> x </identifier>
+    <symbol> = </symbol>
+    <expression>
+      <term>
+        <integerConstant> 1 </integerConstant>
+      </term>
+    </expression>
+    <symbol> ; </symbol>
+  </letStatement>
+  <returnStatement>
+    <keyword> return </keyword>
+    <symbol> ; </symbol>
+  </returnStatement>
+</statements>
+`},
+		{"statements", "", "<statements></statements>\n"},
+		{"subroutineDec", "function void f() { }", `<subroutineDec>
+  <keyword> function </keyword>
+  <keyword> void </keyword>
+  <identifier> f </identifier>
+  <symbol> ( </symbol>
+  <parameterList></parameterList>
+  <symbol> ) </symbol>
+  <subroutineBody>
+    <symbol> { </symbol>
+    <statements></statements>
+    <symbol> } </symbol>
+  </subroutineBody>
+</subroutineDec>
+`},
+		{"classVarDec", "static int a, b;", `<classVarDec>
+  <keyword> static </keyword>
+  <keyword> int </keyword>
+  <identifier> a </identifier>
+  <symbol> , </symbol>
+  <identifier> b </identifier>
+  <symbol> ; </symbol>
+</classVarDec>
+`},
+		{"varDec", "var Array a;", `<varDec>
+  <keyword> var </keyword>
+  <identifier> Array </identifier>
+  <identifier> a </identifier>
+  <symbol> ; </symbol>
+</varDec>
+`},
+		{"expression", "1 2", "1:3: unexpected integerConstant 2 after the end of the expression"},
+		{"statements", "return; }", "1:9: unexpected symbol } after the end of the statements"},
+		{"subroutineDec", "method void f() { return; } method", "1:29: unexpected keyword method after the end of the subroutineDec"},
+		{"classVarDec", "field int x; field", "1:14: unexpected keyword field after the end of the classVarDec"},
+		{"varDec", "var int x; let", "1:12: unexpected keyword let after the end of the varDec"},
+		{"varDec", "var int;", "1:8: expected identifier  , got symbol ;"},
+		{"classVarDec", "var int x;", "1:1: expected keyword static|field, got keyword var"},
+		{"subroutineDec", "int f() { }", "1:1: expected keyword constructor|function|method, got keyword int"},
+	}
+	for _, tt := range tests {
+		tokenizer, err := NewTokenizer(tt.src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree, err := entries[tt.rule](NewCompilationEngine(tokenizer, nil))
+		got := ""
+		if err != nil {
+			var ae *AnalyzerError
+			if !errors.As(err, &ae) {
+				t.Fatalf("%s %q: error without position %v", tt.rule, tt.src, err)
+			}
+			got = fmt.Sprintf("%d:%d: %s", ae.LineNum, ae.Col, ae.Err)
+		} else {
+			got = treeXML(tree)
+		}
+		if !strings.HasPrefix(got, tt.want) {
+			t.Errorf("%s %q:\n%s\nwant:\n%s", tt.rule, tt.src, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+)
+
+// compileStages are the outputs of the toolchain, in pipeline order.
+var compileStages = []string{"vm", "asm", "hack"}
+
+// runCompile implements the compile command: every class of the project
+// is translated to a .vm file next to its source and, up to the requested
+// stage, the whole program to Hack assembly and binary.
+func runCompile(args []string) {
+	fs := flag.NewFlagSet("compile", flag.ExitOnError)
+	var src, stage, osDir string
+	var optimize, stats, keep bool
+	fs.StringVar(&src, "s", "", "source file in jack extension or a directory with multiple jack files")
+	fs.BoolVar(&optimize, "O", false, "fold constants, drop dead branches and run the peephole optimizer")
+	fs.BoolVar(&stats, "stats", false, "compare the instruction counts without and with optimization")
+	fs.StringVar(&stage, "stage", "vm", "last stage of the pipeline: vm, asm (Hack assembly) or hack (Hack binary)")
+	fs.BoolVar(&keep, "keep", false, "also keep the outputs of the stages before the last one")
+	fs.StringVar(&osDir, "os", "", "directory with the Jack OS as .vm or .jack files, linked into asm and hack output")
+	opts := tokenizerFlags(fs)
+	fs.Parse(args)
+	if src == "" {
+		fmt.Println("No source file provided")
+		fs.Usage()
+		os.Exit(1)
+	}
+	last := -1
+	for i, s := range compileStages {
+		if s == stage {
+			last = i
+		}
+	}
+	if last < 0 {
+		fmt.Printf("Unknown stage %s\n", stage)
+		os.Exit(1)
+	}
+	// an earlier stage is written when it is the last one or kept
+	wanted := func(s int) bool { return s == last || keep && s < last }
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if stats {
+		fmt.Fprintln(tw, "class\tplain\toptimized\tsaved\t")
+	}
+	plainTotal, optimizedTotal := 0, 0
+	units := []VMUnit{}
+	for _, sf := range loadProject(src, *opts) {
+		cd := declareClass(sf.Tree)
+		code, err := compileClass(cd, optimize)
+		if err != nil {
+			printError(sf.Path, err)
+			os.Exit(1)
+		}
+		units = append(units, VMUnit{Class: cd.Name, Code: code})
+		if wanted(0) {
+			writeArtifact(sf.Path, strings.TrimSuffix(sf.Path, ".jack")+".vm", vmText(code), !stats)
+		}
+		if stats {
+			plain, _ := compileClass(cd, false)
+			optimized, _ := compileClass(cd, true)
+			p, o := instructionCount(plain), instructionCount(optimized)
+			plainTotal += p
+			optimizedTotal += o
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t\n", cd.Name, p, o, savings(p, o))
+		}
+	}
+	if stats {
+		fmt.Fprintf(tw, "total\t%d\t%d\t%s\t\n", plainTotal, optimizedTotal, savings(plainTotal, optimizedTotal))
+		tw.Flush()
+	}
+	if last == 0 {
+		return
+	}
+
+	if osDir != "" {
+		// classes of the project replace the OS classes of the same name
+		own := map[string]bool{}
+		for _, unit := range units {
+			own[unit.Class] = true
+		}
+		for _, unit := range loadVMUnits(osDir, *opts, optimize) {
+			if !own[unit.Class] {
+				units = append(units, unit)
+			}
+		}
+	}
+	name, dir := projectName(src)
+	asm, err := translateVM(units)
+	if err != nil {
+		fmt.Println("Error translating VM code:", err)
+		os.Exit(1)
+	}
+	if wanted(1) {
+		writeArtifact(src, filepath.Join(dir, name+".asm"), asmText(asm), true)
+	}
+	if last == 1 {
+		return
+	}
+	binary, err := assemble(asm)
+	if err != nil {
+		fmt.Println("Error assembling:", err)
+		os.Exit(1)
+	}
+	writeArtifact(src, filepath.Join(dir, name+".hack"), strings.Join(binary, "\n")+"\n", true)
+}
+
+func writeArtifact(from, path, content string, report bool) {
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		fmt.Printf("Error writing %s: %s\n", path, err)
+		os.Exit(1)
+	}
+	if report {
+		fmt.Printf("Compiled %s to %s ✅\n", from, path)
+	}
+}
+
+func savings(before, after int) string {
+	if before == 0 {
+		return "0%"
+	}
+	return fmt.Sprintf("%.1f%%", 100*float64(before-after)/float64(before))
+}
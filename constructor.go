@@ -0,0 +1,179 @@
+package main
+
+// Constructor conformance rules: constructors must be typed and return like
+// the VM calling convention expects, initialize fields before reading them,
+// and ClassName.new calls across the project must match a constructor.
+
+func lintConstructorType(lc *lintContext, cd *ClassDecl) {
+	for _, sd := range cd.Subroutines {
+		if sd.Kind == KwCONSTRUCTOR && sd.ReturnType != cd.Name {
+			tok := sd.Node.ChildTokens()[1]
+			lc.report("constructor-type", tok, "constructor %s must return %s, not %s", sd.Name, cd.Name, sd.ReturnType)
+		}
+	}
+}
+
+func lintConstructorReturn(lc *lintContext, cd *ClassDecl) {
+	for _, sd := range cd.Subroutines {
+		if sd.Kind != KwCONSTRUCTOR {
+			continue
+		}
+		// every path must end with a return, and every return on a path
+		// must return this; dead returns are left to unreachable-code
+		fa := &flowAnalyzer{}
+		if fa.statements(sd.Body.Child("statements")) {
+			lc.report("constructor-return", sd.NameToken, "not every path of constructor %s ends with return this;", sd.Name)
+		}
+		for _, ret := range fa.returns {
+			if expr := ret.Child("expression"); expr == nil || !isThis(expr) {
+				tok, _ := ret.FirstToken()
+				lc.report("constructor-return", tok, "constructor %s must end with return this;", sd.Name)
+			}
+		}
+	}
+}
+
+// isThis reports whether an expression is the bare this keyword.
+func isThis(expr *Node) bool {
+	tokens := expr.Tokens()
+	return len(tokens) == 1 && tokens[0].Is(KEYWORD, KwTHIS)
+}
+
+func lintFieldInit(lc *lintContext, cd *ClassDecl) {
+	for _, sd := range cd.Subroutines {
+		if sd.Kind != KwCONSTRUCTOR {
+			continue
+		}
+		fi := &fieldInit{lc: lc, cd: cd, sd: sd, reported: map[*VarDecl]bool{}}
+		fi.statements(sd.Body.Child("statements"), map[*VarDecl]bool{})
+	}
+}
+
+// fieldInit follows a constructor in execution order, tracking which fields
+// are assigned on every path so far.
+type fieldInit struct {
+	lc       *lintContext
+	cd       *ClassDecl
+	sd       *SubroutineDecl
+	reported map[*VarDecl]bool
+}
+
+// statements returns the fields initialized after running stmts, given the
+// fields initialized before.
+func (fi *fieldInit) statements(stmts *Node, init map[*VarDecl]bool) map[*VarDecl]bool {
+	for _, st := range stmts.children {
+		switch st.kind {
+		case "letStatement":
+			// the right hand side and the index are evaluated first
+			refs := fi.cd.ReferencesIn(fi.sd, st)
+			for _, ref := range refs[1:] {
+				fi.read(ref, init)
+			}
+			if target := refs[0]; target.Write && target.Var != nil && target.Var.Kind == KwFIELD {
+				init = with(init, target.Var)
+			} else {
+				fi.read(target, init)
+			}
+		case "ifStatement":
+			for _, ref := range fi.cd.ReferencesIn(fi.sd, st.Child("expression")) {
+				fi.read(ref, init)
+			}
+			branches := st.ChildrenOf("statements")
+			thenInit := fi.statements(branches[0], init)
+			thenFalls := (&flowAnalyzer{}).statements(branches[0])
+			elseInit, elseFalls := init, true
+			if len(branches) > 1 {
+				elseInit = fi.statements(branches[1], init)
+				elseFalls = (&flowAnalyzer{}).statements(branches[1])
+			}
+			// a branch that always returns does not reach what follows; of
+			// the others, only fields assigned on every path are known to be
+			// set
+			switch {
+			case !elseFalls:
+				init = thenInit
+			case !thenFalls:
+				init = elseInit
+			default:
+				merged := map[*VarDecl]bool{}
+				for v := range thenInit {
+					if elseInit[v] {
+						merged[v] = true
+					}
+				}
+				init = merged
+			}
+		case "whileStatement":
+			for _, ref := range fi.cd.ReferencesIn(fi.sd, st.Child("expression")) {
+				fi.read(ref, init)
+			}
+			// the body may not run at all
+			fi.statements(st.Child("statements"), init)
+		default:
+			for _, ref := range fi.cd.ReferencesIn(fi.sd, st) {
+				fi.read(ref, init)
+			}
+		}
+	}
+	return init
+}
+
+// read checks a reference against the initialized fields. Calling a method
+// of the object under construction reads the fields that method reads.
+func (fi *fieldInit) read(ref Reference, init map[*VarDecl]bool) {
+	switch {
+	case ref.Kind == RefVar && ref.Var != nil && ref.Var.Kind == KwFIELD && !init[ref.Var]:
+		if !fi.reported[ref.Var] {
+			fi.reported[ref.Var] = true
+			fi.lc.report("field-init", ref.Token, "field %s is read before it is initialized in %s", ref.Var.Name, fi.sd.Name)
+		}
+	case ref.Kind == RefSubroutine && ref.Implicit:
+		callee := fi.cd.Subroutine(ref.Token.tokenValue)
+		if callee == nil || callee.Kind != KwMETHOD {
+			return
+		}
+		for _, calleeRef := range fi.cd.References(callee) {
+			v := calleeRef.Var
+			if calleeRef.Kind != RefVar || v == nil || v.Kind != KwFIELD || calleeRef.Write || init[v] || fi.reported[v] {
+				continue
+			}
+			fi.reported[v] = true
+			fi.lc.report("field-init", ref.Token, "method %s reads field %s before it is initialized in %s", callee.Name, v.Name, fi.sd.Name)
+		}
+	}
+}
+
+// with returns a copy of the set with v added.
+func with(set map[*VarDecl]bool, v *VarDecl) map[*VarDecl]bool {
+	next := map[*VarDecl]bool{v: true}
+	for k := range set {
+		next[k] = true
+	}
+	return next
+}
+
+func lintConstructorCall(lc *lintContext, cd *ClassDecl) {
+	for _, sd := range cd.Subroutines {
+		for _, ref := range cd.References(sd) {
+			if ref.Kind != RefSubroutine || ref.Implicit {
+				continue
+			}
+			target, ok := lc.project[ref.Class]
+			if !ok {
+				// classes outside the project, such as the OS, are not checked
+				continue
+			}
+			name := ref.Token.tokenValue
+			callee := target.Subroutine(name)
+			switch {
+			case callee == nil && name == "new":
+				lc.report("constructor-call", ref.Token, "class %s has no constructor new", target.Name)
+			case callee == nil || callee.Kind != KwCONSTRUCTOR:
+				continue
+			case len(callee.Params) != ref.Args:
+				lc.report("constructor-call", ref.Token, "%s.%s takes %d arguments, called with %d: %s",
+					target.Name, name, len(callee.Params), ref.Args, callee.Signature())
+			}
+		}
+	}
+}
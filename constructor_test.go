@@ -0,0 +1,117 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+// pointNew declares the constructor of the Point fixture.
+const pointNew = "constructor Point new(int ax, boolean c)"
+
+func TestConstructorReturn(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{"return this", "let x = ax; let y = 0; return this;", nil},
+		{"returns another value", "let x = ax; let y = 0; return x;",
+			[]string{"4: constructor new must end with return this;"}},
+		{"falls off the end", "let x = ax; let y = 0;",
+			[]string{"3: not every path of constructor new ends with return this;"}},
+		{"both branches return this", "let x = ax; let y = 0; if (c) { return this; } else { return this; }", nil},
+		{"one branch falls through", "let x = ax; let y = 0; if (c) { return this; }",
+			[]string{"3: not every path of constructor new ends with return this;"}},
+		{"early return of null", "let x = ax; let y = 0; if (c) { return null; }\n return this;",
+			[]string{"4: constructor new must end with return this;"}},
+		{"dead return is left to unreachable-code", "let x = ax; let y = 0; return this;\n return 0;", nil},
+		{"infinite loop", "let x = ax; let y = 0; while (true) { return this; }", nil},
+	}
+	for _, tt := range tests {
+		got := ruleIssues(lintProject(t, subroutineClass(pointNew, tt.body)), "constructor-return")
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: constructor-return issues %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestConstructorType(t *testing.T) {
+	src := `class Point {
+	constructor int new() { return this; }
+}`
+	got := ruleIssues(lintProject(t, src), "constructor-type")
+	want := []string{"2: constructor new must return Point, not int"}
+	if !slices.Equal(got, want) {
+		t.Errorf("constructor-type issues %q, want %q", got, want)
+	}
+}
+
+func TestFieldInit(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{"assigned first", "let x = ax; let y = x; return this;", nil},
+		{"read before assignment", "let y = x; let x = ax; return this;",
+			[]string{"4: field x is read before it is initialized in new"}},
+		{"assigned in one branch only", "if (c) { let x = 1; }\n let y = x; return this;",
+			[]string{"5: field x is read before it is initialized in new"}},
+		{"assigned in both branches", "if (c) { let x = 1; } else { let x = 2; }\n let y = x; return this;", nil},
+		{"assigned in the branch that goes on", "if (c) { let x = 0; return this; } else { let x = 1; }\n let y = getX(); return this;", nil},
+		{"assigned only in the branch that goes on", "if (c) { return this; } else { let x = 1; }\n let y = x; return this;", nil},
+		{"assigned only after the if that returns", "if (c) { return this; }\n let x = 1; let y = x; return this;", nil},
+		{"assigned only in the branch that returns", "if (c) { let x = 0; return this; }\n let y = x; return this;",
+			[]string{"5: field x is read before it is initialized in new"}},
+		{"read in the branch that returns", "if (c) { let y = x; return this; }\n let x = 0; let y = x; return this;",
+			[]string{"4: field x is read before it is initialized in new"}},
+		{"read through a method", "let y = getX(); let x = ax; return this;",
+			[]string{"4: method getX reads field x before it is initialized in new"}},
+	}
+	for _, tt := range tests {
+		got := ruleIssues(lintProject(t, subroutineClass(pointNew, tt.body)), "field-init")
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: field-init issues %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestConstructorCall(t *testing.T) {
+	point := subroutineClass(pointNew, "let x = ax; let y = 0; return this;")
+	tests := []struct {
+		call string
+		want []string
+	}{
+		{"Point.new(1, true)", nil},
+		{"Point.new(1)", []string{"3: Point.new takes 2 arguments, called with 1: constructor Point new(int ax, boolean c)"}},
+		{"Point.create()", nil},
+		{"Output.new()", nil},
+	}
+	for _, tt := range tests {
+		main := `class Main {
+	function void main() {
+		do ` + tt.call + `;
+		return;
+	}
+}`
+		got := ruleIssues(lintProject(t, point, main), "constructor-call")
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: constructor-call issues %q, want %q", tt.call, got, tt.want)
+		}
+	}
+
+	noNew := `class Empty {
+	function Empty make() { return null; }
+}`
+	main := `class Main {
+	function void main() {
+		do Empty.new();
+		return;
+	}
+}`
+	got := ruleIssues(lintProject(t, noNew, main), "constructor-call")
+	want := []string{"3: class Empty has no constructor new"}
+	if !slices.Equal(got, want) {
+		t.Errorf("constructor-call issues %q, want %q", got, want)
+	}
+}
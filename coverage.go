@@ -0,0 +1,134 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// grammarAlt is an alternative of a grammar rule, as recorded by the
+// compilation engine when it tracks coverage.
+type grammarAlt struct {
+	rule, alt string
+}
+
+// grammarAlternatives lists every alternative the compilation engine
+// records, rule by rule in the order of the Jack grammar.
+var grammarAlternatives = []grammarAlt{
+	{"classVarDec", KwSTATIC}, {"classVarDec", KwFIELD},
+	{"classVarDec", "one"}, {"classVarDec", "several"},
+	{"type", KwINT}, {"type", KwCHAR}, {"type", KwBOOLEAN}, {"type", KwVOID}, {"type", "className"},
+	{"subroutineDec", KwCONSTRUCTOR}, {"subroutineDec", KwFUNCTION}, {"subroutineDec", KwMETHOD},
+	{"parameterList", "empty"}, {"parameterList", "one"}, {"parameterList", "several"},
+	{"subroutineBody", "without varDec"}, {"subroutineBody", "with varDec"},
+	{"varDec", "one"}, {"varDec", "several"},
+	{"statements", "empty"},
+	{"statement", KwLET}, {"statement", KwIF}, {"statement", KwWHILE}, {"statement", KwDO}, {"statement", KwRETURN},
+	{"letStatement", "varName"}, {"letStatement", "varName[expression]"},
+	{"ifStatement", "without else"}, {"ifStatement", "with else"},
+	{"returnStatement", "without value"}, {"returnStatement", "with value"},
+	{"expression", "term"}, {"expression", "term op term"},
+	{"term", string(INT_CONST)}, {"term", string(STRING_CONST)}, {"term", "keywordConstant"},
+	{"term", "varName"}, {"term", "varName[expression]"}, {"term", "subroutineCall"},
+	{"term", "(expression)"}, {"term", "unaryOp term"},
+	{"subroutineCall", "subroutineName(expressionList)"}, {"subroutineCall", "name.subroutineName(expressionList)"},
+	{"expressionList", "empty"}, {"expressionList", "one"}, {"expressionList", "several"},
+	{"op", SymPLUS}, {"op", SymMINUS}, {"op", SymSTAR}, {"op", SymSLASH}, {"op", SymAMPERSAND},
+	{"op", SymPIPE}, {"op", SymLT}, {"op", SymGT}, {"op", SymEQ},
+	{"unaryOp", SymMINUS}, {"unaryOp", SymTILDE},
+	{"keywordConstant", KwTRUE}, {"keywordConstant", KwFALSE}, {"keywordConstant", KwNULL}, {"keywordConstant", KwTHIS},
+}
+
+// runCoverage implements the coverage command: it parses a corpus of .jack
+// files and reports which alternatives of the grammar they exercise.
+func runCoverage(args []string) {
+	fs := flag.NewFlagSet("coverage", flag.ExitOnError)
+	var src string
+	var missed bool
+	var minPercent float64
+	fs.StringVar(&src, "s", "", "comma-separated source files in jack extension or directories with multiple jack files")
+	fs.BoolVar(&missed, "missed", false, "only list the alternatives no file exercises")
+	fs.Float64Var(&minPercent, "min", 0, "exit with an error when less than this percentage of the alternatives is hit")
+	opts := tokenizerFlags(fs)
+	fs.Parse(args)
+	if src == "" {
+		fmt.Println("No source file provided")
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	paths := []string{}
+	for _, s := range strings.Split(src, ",") {
+		files, err := listJackFiles(s)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		paths = append(paths, files...)
+	}
+	hits := map[grammarAlt]int{}
+	files := map[grammarAlt]int{} // files exercising each alternative
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Printf("Error reading jack file %s: %s\n", path, err)
+			os.Exit(1)
+		}
+		fileHits, err := grammarCoverage(string(content), *opts)
+		if err != nil {
+			fmt.Println(diagnostic(path, err))
+			os.Exit(1)
+		}
+		for alt, n := range fileHits {
+			hits[alt] += n
+			files[alt]++
+		}
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "rule\talternative\thits\tfiles\t")
+	covered := 0
+	for _, alt := range grammarAlternatives {
+		if hits[alt] > 0 {
+			covered++
+			if missed {
+				continue
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t\n", alt.rule, alt.alt, coverageCount(hits[alt]), files[alt])
+	}
+	tw.Flush()
+
+	percent := 100 * float64(covered) / float64(len(grammarAlternatives))
+	fmt.Printf("%d of %d grammar alternatives hit by %d files (%.1f%%)\n", covered, len(grammarAlternatives), len(paths), percent)
+	if percent < minPercent {
+		fmt.Printf("Coverage below %.1f%%\n", minPercent)
+		os.Exit(1)
+	}
+}
+
+// grammarCoverage parses a class and counts the grammar alternatives its
+// parse takes.
+func grammarCoverage(source string, opts TokenizerOptions) (map[grammarAlt]int, error) {
+	tokenizer, err := NewTokenizer(source, opts)
+	if err != nil {
+		return nil, err
+	}
+	ce := NewCompilationEngine(tokenizer, nil)
+	ce.coverage = map[grammarAlt]int{}
+	if err := ce.ProcessClass(); err != nil {
+		return nil, err
+	}
+	return ce.coverage, nil
+}
+
+// coverageCount marks the alternatives never hit so they stand out.
+func coverageCount(n int) string {
+	if n == 0 {
+		return "MISSED"
+	}
+	return strconv.Itoa(n)
+}
@@ -0,0 +1,87 @@
+package main
+
+import "testing"
+
+// fullCoverage is a class taking every alternative of the grammar.
+const fullCoverage = `class A {
+	static int s;
+	field char c, d;
+	field boolean b;
+	constructor A new() { return this; }
+	function void f(A a) { return; }
+	method int g(int x, Array y) {
+		var int i;
+		var int j, k;
+		let i = 1 + 2 - 3 * 4 / 5 & 6 | 7 < 8 > 9 = 10;
+		let y[i] = "s";
+		if (true) { let j = -i; } else { let k = ~false; }
+		if (null) { }
+		while (x) { do f(null); do a.g(i, y[1], (k)); do Output.println(); }
+		let j = g(x, y);
+		return j;
+	}
+}`
+
+func TestGrammarAlternatives(t *testing.T) {
+	listed := map[grammarAlt]bool{}
+	for _, alt := range grammarAlternatives {
+		if listed[alt] {
+			t.Errorf("%s %s is listed twice", alt.rule, alt.alt)
+		}
+		listed[alt] = true
+	}
+	hits, err := grammarCoverage(fullCoverage, TokenizerOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for alt := range hits {
+		if !listed[alt] {
+			t.Errorf("the engine records %s %s, which grammarAlternatives does not list", alt.rule, alt.alt)
+		}
+	}
+	for _, alt := range grammarAlternatives {
+		if hits[alt] == 0 {
+			t.Errorf("%s %s is never hit", alt.rule, alt.alt)
+		}
+	}
+}
+
+func TestGrammarCoverage(t *testing.T) {
+	tests := []struct {
+		stmts string
+		want  map[grammarAlt]int
+	}{
+		{"let x = 1;", map[grammarAlt]int{
+			{"statement", KwLET}: 1, {"letStatement", "varName"}: 1,
+			{"expression", "term"}: 1, {"term", string(INT_CONST)}: 1,
+			{"letStatement", "varName[expression]"}: 0}},
+		{"let a[x + 1] = a[x];", map[grammarAlt]int{
+			{"letStatement", "varName[expression]"}: 1, {"term", "varName[expression]"}: 1,
+			{"expression", "term op term"}: 1, {"op", SymPLUS}: 1, {"term", "varName"}: 2}},
+		{"if (x) { } else { return; }", map[grammarAlt]int{
+			{"ifStatement", "with else"}: 1, {"ifStatement", "without else"}: 0,
+			{"statements", "empty"}: 1, {"returnStatement", "without value"}: 1}},
+		{"while (~(x < 0)) { do f(); do Math.max(x, 1); }", map[grammarAlt]int{
+			{"statement", KwWHILE}: 1, {"statement", KwDO}: 2,
+			{"unaryOp", SymTILDE}: 1, {"term", "(expression)"}: 1,
+			{"subroutineCall", "subroutineName(expressionList)"}:      1,
+			{"subroutineCall", "name.subroutineName(expressionList)"}: 1,
+			{"expressionList", "empty"}:                               1, {"expressionList", "several"}: 1}},
+		{`return "a" = null;`, map[grammarAlt]int{
+			{"returnStatement", "with value"}: 1, {"term", string(STRING_CONST)}: 1,
+			{"term", "keywordConstant"}: 1, {"keywordConstant", KwNULL}: 1, {"op", SymEQ}: 1}},
+	}
+	for _, tt := range tests {
+		src := "class A { method void m(int x, Array a) { " + tt.stmts + " } }"
+		hits, err := grammarCoverage(src, TokenizerOptions{})
+		if err != nil {
+			t.Errorf("%s: %s", tt.stmts, err)
+			continue
+		}
+		for alt, n := range tt.want {
+			if hits[alt] != n {
+				t.Errorf("%s: %s %s hit %d times, want %d", tt.stmts, alt.rule, alt.alt, hits[alt], n)
+			}
+		}
+	}
+}
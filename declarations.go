@@ -0,0 +1,133 @@
+package main
+
+import "strings"
+
+// ClassDecl summarizes the declarations of a parsed class.
+type ClassDecl struct {
+	Name        string
+	Doc         string
+	Node        *Node
+	Vars        []VarDecl // static and field variables
+	Subroutines []*SubroutineDecl
+}
+
+// VarDecl is a single declared variable: static, field, argument or local.
+type VarDecl struct {
+	Kind  string // static, field, argument or var
+	Type  string
+	Name  string
+	Doc   string
+	Token Token // the name token
+	Node  *Node // the classVarDec, parameterList or varDec declaring it
+}
+
+// SubroutineDecl is a constructor, function or method declaration.
+type SubroutineDecl struct {
+	Kind       string // constructor, function or method
+	ReturnType string
+	Name       string
+	Doc        string
+	NameToken  Token
+	Params     []VarDecl
+	Locals     []VarDecl
+	Node       *Node // subroutineDec
+	Body       *Node // subroutineBody
+}
+
+// Signature renders the declaration as written in Jack, without the body.
+func (sd *SubroutineDecl) Signature() string {
+	params := make([]string, len(sd.Params))
+	for i, p := range sd.Params {
+		params[i] = p.Type + " " + p.Name
+	}
+	return sd.Kind + " " + sd.ReturnType + " " + sd.Name + "(" + strings.Join(params, ", ") + ")"
+}
+
+// Subroutine looks a subroutine of the class up by name.
+func (cd *ClassDecl) Subroutine(name string) *SubroutineDecl {
+	for _, sd := range cd.Subroutines {
+		if sd.Name == name {
+			return sd
+		}
+	}
+	return nil
+}
+
+// declareClass collects the declarations of a class parse tree.
+func declareClass(tree *Node) *ClassDecl {
+	tokens := tree.ChildTokens()
+	cd := &ClassDecl{Name: tokens[1].tokenValue, Doc: docComment(tokens[0]), Node: tree}
+	for _, cv := range tree.ChildrenOf("classVarDec") {
+		cd.Vars = append(cd.Vars, declareVars(cv)...)
+	}
+	for _, sub := range tree.ChildrenOf("subroutineDec") {
+		cd.Subroutines = append(cd.Subroutines, declareSubroutine(sub))
+	}
+	return cd
+}
+
+// declareVars reads the `kind type name (, name)* ;` shape shared by
+// classVarDec and varDec nodes.
+func declareVars(node *Node) []VarDecl {
+	tokens := node.ChildTokens()
+	kind, typ, doc := tokens[0].tokenValue, tokens[1].tokenValue, docComment(tokens[0])
+	vars := []VarDecl{}
+	for _, tok := range tokens[2:] {
+		if tok.tokenType == IDENTIFIER {
+			vars = append(vars, VarDecl{Kind: kind, Type: typ, Name: tok.tokenValue, Doc: doc, Token: tok, Node: node})
+		}
+	}
+	return vars
+}
+
+func declareSubroutine(node *Node) *SubroutineDecl {
+	tokens := node.ChildTokens()
+	sd := &SubroutineDecl{
+		Kind:       tokens[0].tokenValue,
+		ReturnType: tokens[1].tokenValue,
+		Name:       tokens[2].tokenValue,
+		Doc:        docComment(tokens[0]),
+		NameToken:  tokens[2],
+		Node:       node,
+		Body:       node.Child("subroutineBody"),
+	}
+	// the parameter list alternates type and name tokens, separated by commas
+	params := node.Child("parameterList")
+	typ := ""
+	for _, tok := range params.ChildTokens() {
+		switch {
+		case tok.Is(SYMBOL, SymCOMMA):
+		case typ == "":
+			typ = tok.tokenValue
+		default:
+			sd.Params = append(sd.Params, VarDecl{Kind: "argument", Type: typ, Name: tok.tokenValue, Token: tok, Node: params})
+			typ = ""
+		}
+	}
+	for _, vd := range sd.Body.ChildrenOf("varDec") {
+		sd.Locals = append(sd.Locals, declareVars(vd)...)
+	}
+	return sd
+}
+
+// docComment returns the text of the /** */ comment directly preceding a
+// token, with the comment markers and leading asterisks removed.
+func docComment(token Token) string {
+	for i := len(token.leading) - 1; i >= 0; i-- {
+		switch tr := token.leading[i]; tr.kind {
+		case WHITESPACE, NEWLINE:
+			continue
+		case DOC_COMMENT:
+			body := strings.TrimSuffix(strings.TrimPrefix(tr.text, "/**"), "*/")
+			lines := []string{}
+			for _, line := range strings.Split(body, "\n") {
+				line = strings.TrimSpace(line)
+				line = strings.TrimSpace(strings.TrimPrefix(line, "*"))
+				lines = append(lines, line)
+			}
+			return strings.TrimSpace(strings.Join(lines, "\n"))
+		}
+		break
+	}
+	return ""
+}
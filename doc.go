@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// runDoc implements the doc command: it generates an API reference for a
+// project from the /** */ comments preceding its declarations.
+func runDoc(args []string) {
+	fs := flag.NewFlagSet("doc", flag.ExitOnError)
+	var src, format, out string
+	fs.StringVar(&src, "s", "", "source file in jack extension or a directory with multiple jack files")
+	fs.StringVar(&format, "format", "md", "output format: md or html")
+	fs.StringVar(&out, "o", "", "output file (default API.md or API.html next to the sources)")
+	opts := tokenizerFlags(fs)
+	fs.Parse(args)
+	if src == "" {
+		fmt.Println("No source file provided")
+		fs.Usage()
+		os.Exit(1)
+	}
+	if format != "md" && format != "html" {
+		fmt.Printf("Unknown doc format %s\n", format)
+		os.Exit(1)
+	}
+
+	files := loadProject(src, *opts)
+	project, dir := projectName(src)
+	if out == "" {
+		out = filepath.Join(dir, "API."+format)
+	}
+
+	classes := []*ClassDecl{}
+	for _, sf := range files {
+		classes = append(classes, declareClass(sf.Tree))
+	}
+	sort.Slice(classes, func(i, j int) bool { return classes[i].Name < classes[j].Name })
+
+	dw := &docWriter{project: project, classes: map[string]bool{}}
+	for _, cd := range classes {
+		dw.classes[cd.Name] = true
+	}
+	var content string
+	if format == "html" {
+		content = dw.html(classes)
+	} else {
+		content = dw.markdown(classes)
+	}
+	if err := os.WriteFile(out, []byte(content), 0644); err != nil {
+		fmt.Printf("Error writing doc file %s: %s\n", out, err)
+		os.Exit(1)
+	}
+	fmt.Printf("Documentation for %d classes written to %s ✅\n", len(classes), out)
+}
+
+// projectName derives a project name and output directory from the source
+// argument of a command.
+func projectName(src string) (string, string) {
+	if stat, err := os.Stat(src); err == nil && stat.IsDir() {
+		abs, _ := filepath.Abs(src)
+		return filepath.Base(abs), src
+	}
+	return strings.TrimSuffix(filepath.Base(src), ".jack"), filepath.Dir(src)
+}
+
+type docWriter struct {
+	project string
+	classes map[string]bool // classes of the project, for cross-links
+}
+
+func (dw *docWriter) markdown(classes []*ClassDecl) string {
+	buf := bytes.Buffer{}
+	fmt.Fprintf(&buf, "# %s API\n\n", dw.project)
+	for _, cd := range classes {
+		fmt.Fprintf(&buf, "- [%s](#%s)\n", cd.Name, cd.Name)
+	}
+	fmt.Fprintf(&buf, "\n")
+	// markdown link to a type when it is a class of the project
+	typeRef := func(typ string) string {
+		if dw.classes[typ] {
+			return fmt.Sprintf("[%s](#%s)", typ, typ)
+		}
+		return "`" + typ + "`"
+	}
+	for _, cd := range classes {
+		fmt.Fprintf(&buf, "<a id=\"%s\"></a>\n\n## class %s\n\n", cd.Name, cd.Name)
+		if cd.Doc != "" {
+			fmt.Fprintf(&buf, "%s\n\n", cd.Doc)
+		}
+		if len(cd.Vars) > 0 {
+			fmt.Fprintf(&buf, "### Variables\n\n| Kind | Type | Name | Description |\n| --- | --- | --- | --- |\n")
+			for _, v := range cd.Vars {
+				fmt.Fprintf(&buf, "| %s | %s | `%s` | %s |\n", mdCell(v.Kind), mdCell(typeRef(v.Type)), mdCell(v.Name), mdCell(v.Doc))
+			}
+			fmt.Fprintf(&buf, "\n")
+		}
+		if len(cd.Subroutines) > 0 {
+			fmt.Fprintf(&buf, "### Subroutines\n\n")
+		}
+		for _, sd := range cd.Subroutines {
+			params := make([]string, len(sd.Params))
+			for i, p := range sd.Params {
+				params[i] = typeRef(p.Type) + " " + p.Name
+			}
+			fmt.Fprintf(&buf, "<a id=\"%s.%s\"></a>\n\n#### %s.%s\n\n", cd.Name, sd.Name, cd.Name, sd.Name)
+			fmt.Fprintf(&buf, "%s %s **%s**(%s)\n\n", sd.Kind, typeRef(sd.ReturnType), sd.Name, strings.Join(params, ", "))
+			if sd.Doc != "" {
+				fmt.Fprintf(&buf, "%s\n\n", sd.Doc)
+			}
+		}
+	}
+	return buf.String()
+}
+
+// mdCell escapes text for a markdown table cell, where a | ends the cell and
+// a line break ends the row.
+func mdCell(s string) string { return mdCellEscaper.Replace(s) }
+
+var mdCellEscaper = strings.NewReplacer("|", "\\|", "\r\n", " ", "\n", " ", "\r", " ")
+
+func (dw *docWriter) html(classes []*ClassDecl) string {
+	buf := bytes.Buffer{}
+	esc := xmlEscape
+	// html link to a type when it is a class of the project
+	typeRef := func(typ string) string {
+		if dw.classes[typ] {
+			return fmt.Sprintf("<a href=\"#%s\">%s</a>", esc(typ), esc(typ))
+		}
+		return "<span class=\"type\">" + esc(typ) + "</span>"
+	}
+	// doc comments keep their paragraphs
+	paragraphs := func(doc string) string {
+		return "<p>" + strings.ReplaceAll(esc(doc), "\n\n", "</p><p>") + "</p>"
+	}
+	fmt.Fprintf(&buf, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>%s API</title>\n", esc(dw.project))
+	fmt.Fprintf(&buf, "<style>\nbody { font-family: sans-serif; max-width: 60em; margin: auto; }\n"+
+		"code { background: #f4f4f4; padding: 0.2em 0.4em; }\n.type { color: #07a; }\n"+
+		"table { border-collapse: collapse; }\ntd, th { border: 1px solid #ccc; padding: 0.3em 0.6em; }\n</style>\n</head>\n<body>\n")
+	fmt.Fprintf(&buf, "<h1>%s API</h1>\n<ul>\n", esc(dw.project))
+	for _, cd := range classes {
+		fmt.Fprintf(&buf, "<li><a href=\"#%s\">%s</a></li>\n", esc(cd.Name), esc(cd.Name))
+	}
+	fmt.Fprintf(&buf, "</ul>\n")
+	for _, cd := range classes {
+		fmt.Fprintf(&buf, "<h2 id=\"%s\">class %s</h2>\n", esc(cd.Name), esc(cd.Name))
+		if cd.Doc != "" {
+			fmt.Fprintf(&buf, "%s\n", paragraphs(cd.Doc))
+		}
+		if len(cd.Vars) > 0 {
+			fmt.Fprintf(&buf, "<h3>Variables</h3>\n<table>\n<tr><th>Kind</th><th>Type</th><th>Name</th><th>Description</th></tr>\n")
+			for _, v := range cd.Vars {
+				fmt.Fprintf(&buf, "<tr><td>%s</td><td>%s</td><td><code>%s</code></td><td>%s</td></tr>\n",
+					esc(v.Kind), typeRef(v.Type), esc(v.Name), esc(v.Doc))
+			}
+			fmt.Fprintf(&buf, "</table>\n")
+		}
+		if len(cd.Subroutines) > 0 {
+			fmt.Fprintf(&buf, "<h3>Subroutines</h3>\n")
+		}
+		for _, sd := range cd.Subroutines {
+			params := make([]string, len(sd.Params))
+			for i, p := range sd.Params {
+				params[i] = typeRef(p.Type) + " " + esc(p.Name)
+			}
+			fmt.Fprintf(&buf, "<h4 id=\"%s.%s\">%s.%s</h4>\n", esc(cd.Name), esc(sd.Name), esc(cd.Name), esc(sd.Name))
+			fmt.Fprintf(&buf, "<p><code>%s %s <b>%s</b>(%s)</code></p>\n", esc(sd.Kind), typeRef(sd.ReturnType), esc(sd.Name), strings.Join(params, ", "))
+			if sd.Doc != "" {
+				fmt.Fprintf(&buf, "%s\n", paragraphs(sd.Doc))
+			}
+		}
+	}
+	fmt.Fprintf(&buf, "</body>\n</html>\n")
+	return buf.String()
+}
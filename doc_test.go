@@ -0,0 +1,32 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDocMarkdownTableCells(t *testing.T) {
+	src := `class Flags {
+	/** either a | b,
+	 * never both */
+	field int mode;
+}`
+	sf, err := parseSource("Flags.jack", src, TokenizerOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cd := declareClass(sf.Tree)
+	dw := &docWriter{project: "Flags", classes: map[string]bool{cd.Name: true}}
+	md := dw.markdown([]*ClassDecl{cd})
+	for _, line := range strings.Split(md, "\n") {
+		if !strings.Contains(line, "`mode`") {
+			continue
+		}
+		want := "| field | `int` | `mode` | either a \\| b, never both |"
+		if line != want {
+			t.Fatalf("variable row = %q, want %q", line, want)
+		}
+		return
+	}
+	t.Fatalf("no row for mode in\n%s", md)
+}
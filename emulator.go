@@ -0,0 +1,501 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Hack memory map, as laid out by the VM translator and the Jack OS.
+const (
+	ramSP       = 0
+	ramLCL      = 1
+	ramARG      = 2
+	ramTHIS     = 3
+	ramTHAT     = 4
+	ramTemp     = 5
+	ramStatic   = 16
+	ramStack    = 256
+	ramHeap     = 2048
+	ramScreen   = 16384
+	ramKeyboard = 24576
+
+	screenWidth  = 512
+	screenHeight = 256
+)
+
+// vmArity is the number of arguments of each VM command.
+var vmArity = map[string]int{
+	"push": 2, "pop": 2, "function": 2, "call": 2,
+	"label": 1, "goto": 1, "if-goto": 1,
+	"add": 0, "sub": 0, "neg": 0, "eq": 0, "gt": 0, "lt": 0,
+	"and": 0, "or": 0, "not": 0, "return": 0,
+}
+
+// parseVM reads the text of a .vm file.
+func parseVM(text string) ([]VMCommand, error) {
+	code := []VMCommand{}
+	for i, line := range strings.Split(text, "\n") {
+		line, _, _ = strings.Cut(line, "//")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		arity, ok := vmArity[fields[0]]
+		if !ok {
+			return nil, fmt.Errorf("line %d: unknown VM command %s", i+1, fields[0])
+		}
+		if len(fields) != arity+1 {
+			return nil, fmt.Errorf("line %d: %s takes %d arguments", i+1, fields[0], arity)
+		}
+		c := VMCommand{Op: fields[0]}
+		if arity > 0 {
+			c.Arg = fields[1]
+		}
+		if arity > 1 {
+			n, err := strconv.Atoi(fields[2])
+			if err != nil || n < 0 || n > maxIntConst {
+				return nil, fmt.Errorf("line %d: invalid index %s", i+1, fields[2])
+			}
+			c.Index = n
+		}
+		code = append(code, c)
+	}
+	return code, nil
+}
+
+// VMUnit is the VM code of one class, the scope of its static segment.
+type VMUnit struct {
+	Class string
+	Code  []VMCommand
+}
+
+// VMProgram is the linked code of all the classes of a program.
+type VMProgram struct {
+	code      []VMCommand
+	statics   []int // static segment base of each command
+	functions map[string]int
+	labels    map[string]int // by function$label, labels being local to functions
+}
+
+// linkVM concatenates the units, gives every class its own range of the
+// static segment and indexes the functions.
+func linkVM(units []VMUnit) (*VMProgram, error) {
+	prog := &VMProgram{functions: map[string]int{}, labels: map[string]int{}}
+	base := ramStatic
+	function := ""
+	for _, unit := range units {
+		size := 0
+		for _, c := range unit.Code {
+			switch c.Op {
+			case "function":
+				if _, ok := prog.functions[c.Arg]; ok {
+					return nil, fmt.Errorf("function %s is defined twice", c.Arg)
+				}
+				if !strings.Contains(c.Arg, ".") {
+					return nil, fmt.Errorf("function name %s is not qualified by its class", c.Arg)
+				}
+				function = c.Arg
+				prog.functions[function] = len(prog.code)
+			case "label":
+				if function == "" {
+					return nil, fmt.Errorf("label %s is outside of any function", c.Arg)
+				}
+				prog.labels[function+"$"+c.Arg] = len(prog.code)
+			}
+			if (c.Op == "push" || c.Op == "pop") && c.Arg == "static" {
+				size = max(size, c.Index+1)
+			}
+			prog.code = append(prog.code, c)
+			prog.statics = append(prog.statics, base)
+		}
+		base += size
+	}
+	if base > ramStack {
+		return nil, fmt.Errorf("the program uses %d static variables, more than the %d available", base-ramStatic, ramStack-ramStatic)
+	}
+	if len(prog.code) > 0xFFFF {
+		return nil, fmt.Errorf("the program has %d commands, more than the %d return addresses can reach", len(prog.code), 0xFFFF)
+	}
+	return prog, nil
+}
+
+// errHalt stops the machine without reporting an error.
+var errHalt = errors.New("halt")
+
+// Machine runs a VMProgram on the Hack memory map. Calls of functions the
+// program does not define go to the native Jack OS.
+type Machine struct {
+	RAM   [ramKeyboard + 1]int16
+	OS    *JackOS
+	Trace io.Writer // when set, every executed command is written to it
+	Steps int
+
+	prog   *VMProgram
+	pc     int
+	calls  []string // names of the active functions, innermost last
+	halted bool
+}
+
+// NewMachine prepares prog to run from Sys.init when the program defines
+// it and from Main.main otherwise, returning to a halt.
+func NewMachine(prog *VMProgram, jos *JackOS) (*Machine, error) {
+	m := &Machine{OS: jos, prog: prog}
+	m.RAM[ramSP] = ramStack
+	entry := "Sys.init"
+	if _, ok := prog.functions[entry]; !ok {
+		entry = "Main.main"
+	}
+	if _, ok := prog.functions[entry]; !ok {
+		return nil, errors.New("the program has no Sys.init or Main.main function")
+	}
+	// returning to the address past the last command halts
+	m.pc = len(prog.code)
+	if err := m.call(entry, 0); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Halted tells whether the program has finished.
+func (m *Machine) Halted() bool { return m.halted }
+
+// Function returns the name of the function being executed.
+func (m *Machine) Function() string {
+	if len(m.calls) == 0 {
+		return ""
+	}
+	return m.calls[len(m.calls)-1]
+}
+
+// Next returns the command executed by the next Step.
+func (m *Machine) Next() VMCommand {
+	if m.pc >= len(m.prog.code) {
+		return VMCommand{}
+	}
+	return m.prog.code[m.pc]
+}
+
+// Run steps until the program halts, fails or maxSteps commands ran; zero
+// means no limit.
+func (m *Machine) Run(maxSteps int) error {
+	for !m.halted {
+		if maxSteps > 0 && m.Steps >= maxSteps {
+			return fmt.Errorf("stopped after %d steps in %s", m.Steps, m.Function())
+		}
+		if err := m.Step(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Step executes a single command.
+func (m *Machine) Step() error {
+	if m.halted {
+		return nil
+	}
+	if m.pc >= len(m.prog.code) {
+		m.halted = true
+		return nil
+	}
+	c := m.prog.code[m.pc]
+	if m.Trace != nil {
+		fmt.Fprintf(m.Trace, "%8d  %-28s %-28s SP=%d\n", m.Steps, m.Function(), c, m.RAM[ramSP])
+	}
+	m.Steps++
+	err := m.execute(c)
+	if errors.Is(err, errHalt) {
+		m.halted = true
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("runtime error in %s at step %d (%s): %w", m.Function(), m.Steps, c, err)
+	}
+	return nil
+}
+
+func (m *Machine) execute(c VMCommand) error {
+	next := m.pc + 1
+	switch c.Op {
+	case "push":
+		v, err := m.segmentRead(c.Arg, c.Index)
+		if err != nil {
+			return err
+		}
+		if err := m.push(v); err != nil {
+			return err
+		}
+	case "pop":
+		v, err := m.pop()
+		if err != nil {
+			return err
+		}
+		if err := m.segmentWrite(c.Arg, c.Index, v); err != nil {
+			return err
+		}
+	case "add", "sub", "eq", "gt", "lt", "and", "or":
+		b, err := m.pop()
+		if err != nil {
+			return err
+		}
+		a, err := m.pop()
+		if err != nil {
+			return err
+		}
+		m.push(vmBinary(c.Op, a, b))
+	case "neg", "not":
+		a, err := m.pop()
+		if err != nil {
+			return err
+		}
+		if c.Op == "neg" {
+			m.push(-a)
+		} else {
+			m.push(^a)
+		}
+	case "label":
+	case "goto":
+		target, err := m.label(c.Arg)
+		if err != nil {
+			return err
+		}
+		if target == m.pc-1 {
+			// `label L; goto L` is how programs halt. Nothing can break
+			// the loop: the machine has no interrupts and the keyboard
+			// script only moves when the program calls the OS, so even a
+			// pending key would never end it.
+			return errHalt
+		}
+		next = target
+	case "if-goto":
+		v, err := m.pop()
+		if err != nil {
+			return err
+		}
+		if v != 0 {
+			target, err := m.label(c.Arg)
+			if err != nil {
+				return err
+			}
+			next = target
+		}
+	case "function":
+		for range c.Index {
+			if err := m.push(0); err != nil {
+				return err
+			}
+		}
+	case "call":
+		m.pc = next
+		return m.call(c.Arg, c.Index)
+	case "return":
+		return m.ret()
+	}
+	m.pc = next
+	return nil
+}
+
+func vmBinary(op string, a, b int16) int16 {
+	boolean := func(v bool) int16 {
+		if v {
+			return -1
+		}
+		return 0
+	}
+	switch op {
+	case "add":
+		return a + b
+	case "sub":
+		return a - b
+	case "eq":
+		return boolean(a == b)
+	case "gt":
+		return boolean(a > b)
+	case "lt":
+		return boolean(a < b)
+	case "and":
+		return a & b
+	}
+	return a | b
+}
+
+// call enters a function with the n arguments on top of the stack; m.pc
+// must already hold the return address.
+func (m *Machine) call(name string, n int) error {
+	target, ok := m.prog.functions[name]
+	if !ok {
+		return m.callNative(name, n)
+	}
+	sp := int(m.RAM[ramSP])
+	frame := []int16{int16(uint16(m.pc)), m.RAM[ramLCL], m.RAM[ramARG], m.RAM[ramTHIS], m.RAM[ramTHAT]}
+	for _, v := range frame {
+		if err := m.push(v); err != nil {
+			return err
+		}
+	}
+	m.RAM[ramARG] = int16(sp - n)
+	m.RAM[ramLCL] = m.RAM[ramSP]
+	m.calls = append(m.calls, name)
+	m.pc = target
+	return nil
+}
+
+func (m *Machine) callNative(name string, n int) error {
+	native, arity, ok := m.OS.native(name)
+	if !ok {
+		return fmt.Errorf("call of undefined function %s", name)
+	}
+	if n != arity {
+		return fmt.Errorf("%s takes %d arguments, called with %d", name, arity, n)
+	}
+	sp := int(m.RAM[ramSP])
+	if sp-n < ramStack {
+		return errors.New("stack underflow")
+	}
+	args := make([]int16, n)
+	copy(args, m.RAM[sp-n:sp])
+	m.RAM[ramSP] = int16(sp - n)
+	v, err := native(m, args)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return m.push(v)
+}
+
+func (m *Machine) ret() error {
+	if len(m.calls) == 0 {
+		return errors.New("return outside of a call")
+	}
+	frame := int(m.RAM[ramLCL])
+	if frame < ramStack+5 {
+		return errors.New("return outside of a function")
+	}
+	// the return address is read first: with no arguments, the return
+	// value overwrites it
+	retAddr := int(uint16(m.RAM[frame-5]))
+	v, err := m.pop()
+	if err != nil {
+		return err
+	}
+	arg := int(m.RAM[ramARG])
+	m.RAM[arg] = v
+	m.RAM[ramSP] = int16(arg + 1)
+	m.RAM[ramTHAT] = m.RAM[frame-1]
+	m.RAM[ramTHIS] = m.RAM[frame-2]
+	m.RAM[ramARG] = m.RAM[frame-3]
+	m.RAM[ramLCL] = m.RAM[frame-4]
+	m.pc = retAddr
+	m.calls = m.calls[:len(m.calls)-1]
+	return nil
+}
+
+// label finds a label of the current function.
+func (m *Machine) label(name string) (int, error) {
+	if target, ok := m.prog.labels[m.Function()+"$"+name]; ok {
+		return target, nil
+	}
+	return 0, fmt.Errorf("unknown label %s", name)
+}
+
+func (m *Machine) push(v int16) error {
+	sp := int(m.RAM[ramSP])
+	if sp >= ramHeap {
+		return errors.New("stack overflow")
+	}
+	m.RAM[sp] = v
+	m.RAM[ramSP]++
+	return nil
+}
+
+func (m *Machine) pop() (int16, error) {
+	sp := int(m.RAM[ramSP])
+	if sp <= ramStack {
+		return 0, errors.New("stack underflow")
+	}
+	m.RAM[ramSP]--
+	return m.RAM[sp-1], nil
+}
+
+// address maps a segment index to its RAM address.
+func (m *Machine) address(segment string, index int) (int, error) {
+	limit, addr := 0, 0
+	switch segment {
+	case "local":
+		addr = int(m.RAM[ramLCL]) + index
+	case "argument":
+		addr = int(m.RAM[ramARG]) + index
+	case "this":
+		addr = int(m.RAM[ramTHIS]) + index
+	case "that":
+		addr = int(m.RAM[ramTHAT]) + index
+	case "pointer":
+		limit, addr = 2, ramTHIS+index
+	case "temp":
+		limit, addr = 8, ramTemp+index
+	case "static":
+		addr = m.prog.statics[m.pc] + index
+	default:
+		return 0, fmt.Errorf("unknown segment %s", segment)
+	}
+	if limit > 0 && index >= limit {
+		return 0, fmt.Errorf("%s %d is out of the segment", segment, index)
+	}
+	return m.checkAddress(addr)
+}
+
+func (m *Machine) checkAddress(addr int) (int, error) {
+	if addr < 0 || addr > ramKeyboard {
+		return 0, fmt.Errorf("illegal memory address %d", addr)
+	}
+	return addr, nil
+}
+
+func (m *Machine) segmentRead(segment string, index int) (int16, error) {
+	if segment == "constant" {
+		return int16(index), nil
+	}
+	addr, err := m.address(segment, index)
+	if err != nil {
+		return 0, err
+	}
+	return m.RAM[addr], nil
+}
+
+func (m *Machine) segmentWrite(segment string, index int, v int16) error {
+	if segment == "constant" {
+		return errors.New("cannot pop to the constant segment")
+	}
+	addr, err := m.address(segment, index)
+	if err != nil {
+		return err
+	}
+	m.RAM[addr] = v
+	return nil
+}
+
+// Screen renders the screen memory map, black pixels for set bits.
+func (m *Machine) Screen() *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, screenWidth, screenHeight))
+	for y := range screenHeight {
+		for x := range screenWidth {
+			word := m.RAM[ramScreen+y*screenWidth/16+x/16]
+			if word>>(x%16)&1 == 1 {
+				img.SetGray(x, y, color.Gray{Y: 0})
+			} else {
+				img.SetGray(x, y, color.Gray{Y: 255})
+			}
+		}
+	}
+	return img
+}
+
+// WriteScreenPNG saves the screen as a PNG image.
+func (m *Machine) WriteScreenPNG(w io.Writer) error {
+	return png.Encode(w, m.Screen())
+}
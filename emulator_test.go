@@ -0,0 +1,134 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// runJack compiles the classes of a program and runs it with the given
+// keyboard script.
+func runJack(t *testing.T, keys string, srcs ...string) *Machine {
+	t.Helper()
+	return runUnits(t, keys, compileSources(t, false, srcs...))
+}
+
+// compileSources compiles the classes of a program to VM code.
+func compileSources(t *testing.T, optimize bool, srcs ...string) []VMUnit {
+	t.Helper()
+	units := []VMUnit{}
+	_, classes := declareProject(t, srcs...)
+	for _, cd := range classes {
+		code, err := compileClass(cd, optimize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		units = append(units, VMUnit{Class: cd.Name, Code: code})
+	}
+	return units
+}
+
+// runUnits links VM code and runs it to the end.
+func runUnits(t *testing.T, keys string, units []VMUnit) *Machine {
+	t.Helper()
+	prog, err := linkVM(units)
+	if err != nil {
+		t.Fatal(err)
+	}
+	script, err := parseKeyScript(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewMachine(prog, NewJackOS(script))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Run(1000000); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestKeyboardReadIntFreesItsLine(t *testing.T) {
+	m := runJack(t, "1\n20\n300\n", `class Main {
+	function void main() {
+		var String prompt;
+		var int i, sum;
+		let prompt = "n? ";
+		while (i < 3) {
+			let sum = sum + Keyboard.readInt(prompt);
+			let i = i + 1;
+		}
+		do prompt.dispose();
+		do Output.printInt(sum);
+		return;
+	}
+}`)
+	if out := m.OS.Output(); !strings.HasSuffix(strings.TrimSpace(out), "321") {
+		t.Errorf("output %q does not end with the sum 321", out)
+	}
+	if n := len(m.OS.allocated); n != 0 {
+		t.Errorf("%d heap blocks still allocated after the program freed its strings", n)
+	}
+}
+
+// runVM links and runs the VM code of a Main class for at most maxSteps.
+func runVM(t *testing.T, keys, code string, maxSteps int) (*Machine, error) {
+	t.Helper()
+	commands, err := parseVM(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prog, err := linkVM([]VMUnit{{Class: "Main", Code: commands}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	script, err := parseKeyScript(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewMachine(prog, NewJackOS(script))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m, m.Run(maxSteps)
+}
+
+func TestHaltOnGotoItsOwnLabel(t *testing.T) {
+	tests := []struct {
+		name, keys, code string
+		halts            bool
+	}{
+		{"goto its own label", "", "function Main.main 0\nlabel END\ngoto END\n", true},
+		{"with keys pending", "abc", "function Main.main 0\nlabel END\ngoto END\n", true},
+		{"loop with a body", "", "function Main.main 0\nlabel LOOP\npush constant 0\npop temp 0\ngoto LOOP\n", false},
+		{"polling the keyboard", "a", "function Main.main 0\nlabel WAIT\ncall Keyboard.keyPressed 0\nif-goto DONE\ngoto WAIT\nlabel DONE\nlabel END\ngoto END\n", true},
+	}
+	for _, tt := range tests {
+		m, err := runVM(t, tt.keys, tt.code, 1000)
+		if tt.halts && (err != nil || !m.Halted() || m.Steps > 10) {
+			t.Errorf("%s: halted %v after %d steps, error %v", tt.name, m.Halted(), m.Steps, err)
+		}
+		if !tt.halts && (err == nil || m.Halted()) {
+			t.Errorf("%s: halted %v after %d steps, want to run out of steps", tt.name, m.Halted(), m.Steps)
+		}
+	}
+}
+
+func TestReturnOutsideOfACall(t *testing.T) {
+	// Main.main points its saved return address at its own return and its
+	// saved LCL at a plausible frame, so that it returns twice
+	code := `function Main.main 0
+push constant 256
+pop pointer 0
+push constant 8
+pop this 0
+push constant 300
+pop this 1
+push constant 0
+return
+`
+	_, err := runVM(t, "", code, 1000)
+	if err == nil || !strings.HasSuffix(err.Error(), "return outside of a call") {
+		t.Errorf("error %v, want a return outside of a call", err)
+	}
+}
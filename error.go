@@ -10,6 +10,7 @@ type AnalyzerError struct {
 	Err     error
 	Line    string
 	LineNum int
+	Col     int
 	Stack   string
 }
 
@@ -22,6 +23,7 @@ func NewTokenErr(token Token, msg string, args ...any) *AnalyzerError {
 		Err:     fmt.Errorf(msg, args...),
 		Line:    token.tokenValue,
 		LineNum: token.lineNum,
+		Col:     token.colNum,
 		Stack:   string(getStack()),
 	}
 }
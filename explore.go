@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+)
+
+// explorerNode is a parse tree node as the explorer page reads it. The
+// offsets are counted in UTF-16 code units, like JavaScript strings.
+type explorerNode struct {
+	Kind     string          `json:"k"`
+	Text     string          `json:"t"`
+	Start    int             `json:"s"`
+	End      int             `json:"e"`
+	Children []*explorerNode `json:"c"` // null for tokens
+}
+
+// runExplore implements the explore command: every .jack file gets a
+// self-contained page showing its source next to its collapsible parse
+// tree, each highlighting the other on click.
+func runExplore(args []string) {
+	fs := flag.NewFlagSet("explore", flag.ExitOnError)
+	var src, out string
+	fs.StringVar(&src, "s", "", "source file in jack extension or a directory with multiple jack files")
+	fs.StringVar(&out, "o", "", "output directory (default: next to the sources)")
+	opts := tokenizerFlags(fs)
+	fs.Parse(args)
+	if src == "" {
+		fmt.Println("No source file provided")
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	for _, sf := range loadProject(src, *opts) {
+		path := strings.TrimSuffix(sf.Path, ".jack") + ".explore.html"
+		if out != "" {
+			path = filepath.Join(out, filepath.Base(path))
+		}
+		page, err := explorerPage(sf)
+		if err != nil {
+			fmt.Printf("Error rendering %s: %s\n", sf.Path, err)
+			os.Exit(1)
+		}
+		if err := os.WriteFile(path, []byte(page), 0644); err != nil {
+			fmt.Printf("Error writing explorer file %s: %s\n", path, err)
+			os.Exit(1)
+		}
+		fmt.Printf("Explorer for %s written to %s ✅\n", sf.Path, path)
+	}
+}
+
+// explorerPage renders the explorer of a parsed file. The source and the
+// tree are embedded as JSON, which escapes <, > and & so that the data
+// cannot close its script element.
+func explorerPage(sf *SourceFile) (string, error) {
+	offsets := utf16Offsets(sf.Source)
+	var convert func(n *Node) *explorerNode
+	convert = func(n *Node) *explorerNode {
+		start, end := n.Span()
+		en := &explorerNode{Kind: n.kind, Start: offsets[start], End: offsets[end]}
+		if n.IsToken() {
+			en.Text = n.token.tokenValue
+		} else {
+			en.Children = []*explorerNode{}
+		}
+		for _, c := range n.children {
+			en.Children = append(en.Children, convert(c))
+		}
+		return en
+	}
+	data, err := json.Marshal(struct {
+		Source string        `json:"source"`
+		Tree   *explorerNode `json:"tree"`
+	}{sf.Source, convert(sf.Tree)})
+	if err != nil {
+		return "", err
+	}
+	return strings.NewReplacer(
+		"{{title}}", xmlEscape(filepath.Base(sf.Path)),
+		"{{data}}", string(data),
+	).Replace(explorerTemplate), nil
+}
+
+// utf16Offsets maps the byte offset of every rune of s, and the length of
+// s, to its JavaScript string index.
+func utf16Offsets(s string) []int {
+	offsets := make([]int, len(s)+1)
+	units := 0
+	for i, r := range s {
+		offsets[i] = units
+		units += utf16.RuneLen(r)
+	}
+	offsets[len(s)] = units
+	return offsets
+}
+
+const explorerTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{title}} parse tree</title>
+<style>
+body { margin: 0; font-family: sans-serif; display: flex; flex-direction: column; height: 100vh; }
+header { padding: 0.5em 1em; background: #f4f4f4; border-bottom: 1px solid #ddd; }
+header small { color: #666; margin-left: 1em; }
+#status { font-family: monospace; margin-left: 1em; }
+main { flex: 1; display: flex; min-height: 0; }
+#source, #tree { flex: 1; overflow: auto; margin: 0; padding: 0.5em 1em; }
+#source { font-family: monospace; white-space: pre; border-right: 1px solid #ddd; }
+#tree { font-size: 0.9em; }
+#tree ul { list-style: none; margin: 0; padding-left: 1.2em; }
+#tree > ul { padding-left: 0; }
+.node { cursor: pointer; padding: 0 0.2em; border-radius: 3px; white-space: nowrap; }
+.node:hover { background: #eef; }
+.node code { color: #a31515; }
+.leaf { color: #555; }
+.caret { display: inline-block; width: 1em; color: #999; }
+.collapsed > ul { display: none; }
+.tok { cursor: pointer; }
+.keyword { color: #00c; font-weight: bold; }
+.integerConstant { color: #098658; }
+.stringConstant { color: #a31515; }
+.identifier { color: #001080; }
+.gap { color: #008000; }
+.hl { background: #fff3a8; }
+.selected { background: #ffe066; }
+</style>
+</head>
+<body>
+<header><b>{{title}}</b><small>click a tree node to highlight its source, click the source to find its node and again to select the enclosing rule</small><span id="status"></span></header>
+<main><pre id="source"></pre><div id="tree"></div></main>
+<script type="application/json" id="data">{{data}}</script>
+<script>
+const data = JSON.parse(document.getElementById('data').textContent);
+const source = data.source;
+const leaves = [];
+
+// link the nodes to their parents and record the range of leaves each covers
+function index(n, parent) {
+  n.parent = parent;
+  n.first = leaves.length;
+  if (!n.c) {
+    leaves.push(n);
+  } else {
+    n.c.forEach(c => index(c, n));
+  }
+  n.last = leaves.length - 1;
+}
+index(data.tree, null);
+
+function position(offset) {
+  const before = source.slice(0, offset).split('\n');
+  return before.length + ':' + (before[before.length - 1].length + 1);
+}
+
+const sourcePane = document.getElementById('source');
+let pos = 0;
+function gap(end) {
+  if (end > pos) {
+    const span = document.createElement('span');
+    span.className = 'gap';
+    span.textContent = source.slice(pos, end);
+    sourcePane.appendChild(span);
+  }
+}
+leaves.forEach(leaf => {
+  gap(leaf.s);
+  const span = document.createElement('span');
+  span.className = 'tok ' + leaf.k;
+  span.textContent = source.slice(leaf.s, leaf.e);
+  span.onclick = () => {
+    // a click inside the selection walks up to the enclosing rule
+    const inside = selected && selected.first <= leaf.first && leaf.first <= selected.last;
+    select(inside && selected.parent ? selected.parent : leaf);
+  };
+  leaf.span = span;
+  sourcePane.appendChild(span);
+  pos = leaf.e;
+});
+gap(source.length);
+
+const treePane = document.getElementById('tree');
+function build(n, depth) {
+  const li = document.createElement('li');
+  const row = document.createElement('div');
+  row.className = 'node' + (n.c ? '' : ' leaf');
+  const caret = document.createElement('span');
+  caret.className = 'caret';
+  caret.textContent = n.c ? '▾' : '';
+  row.appendChild(caret);
+  row.appendChild(document.createTextNode(n.k + ' '));
+  if (!n.c) {
+    const code = document.createElement('code');
+    code.textContent = n.t;
+    row.appendChild(code);
+  }
+  row.onclick = event => {
+    if (n.c && event.target === caret) {
+      li.classList.toggle('collapsed');
+      caret.textContent = li.classList.contains('collapsed') ? '▸' : '▾';
+      return;
+    }
+    select(n);
+  };
+  li.appendChild(row);
+  n.li = li;
+  n.row = row;
+  n.caret = caret;
+  if (n.c) {
+    const ul = document.createElement('ul');
+    n.c.forEach(c => ul.appendChild(build(c, depth + 1)));
+    li.appendChild(ul);
+    if (depth >= 2) {
+      li.classList.add('collapsed');
+      caret.textContent = '▸';
+    }
+  }
+  return li;
+}
+const root = document.createElement('ul');
+root.appendChild(build(data.tree, 0));
+treePane.appendChild(root);
+
+let selected = null;
+function select(n) {
+  document.querySelectorAll('.hl, .selected').forEach(e => e.classList.remove('hl', 'selected'));
+  selected = n;
+  for (let p = n.parent; p; p = p.parent) {
+    p.li.classList.remove('collapsed');
+    p.caret.textContent = '▾';
+  }
+  n.row.classList.add('selected');
+  n.row.scrollIntoView({block: 'nearest'});
+  if (n.first <= n.last) {
+    // highlight the tokens of the node and the text between them
+    const first = leaves[n.first].span, last = leaves[n.last].span;
+    for (let e = first; e; e = e.nextSibling) {
+      e.classList.add('hl');
+      if (e === last) break;
+    }
+    first.scrollIntoView({block: 'nearest'});
+  }
+  document.getElementById('status').textContent = n.k + ' ' + position(n.s) + '–' + position(n.e);
+}
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestUTF16Offsets(t *testing.T) {
+	tests := []struct {
+		s    string
+		want []int // at the start of every rune, then at the end
+	}{
+		{"", []int{0}},
+		{"ab", []int{0, 1, 2}},
+		{"é!", []int{0, 1, 2}}, // two bytes, one unit
+		{"€!", []int{0, 1, 2}}, // three bytes, one unit
+		{"😀!", []int{0, 2, 3}}, // four bytes, a surrogate pair
+	}
+	for _, tt := range tests {
+		offsets := utf16Offsets(tt.s)
+		got := []int{}
+		for i := range tt.s {
+			got = append(got, offsets[i])
+		}
+		got = append(got, offsets[len(tt.s)])
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%q: offsets %v, want %v", tt.s, got, tt.want)
+		}
+	}
+}
+
+// spanText returns the source a node spans.
+func spanText(sf *SourceFile, n *Node) string {
+	start, end := n.Span()
+	return sf.Source[start:end]
+}
+
+func TestNodeSpans(t *testing.T) {
+	src := "/** A. */\nclass A {\n  function void f() {\n    let x = (1 + g(2)) ; // set\n  }\n  function void h() { /* none */ }\n}\n"
+	sf, err := parseSource("A.jack", src, TokenizerOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub := sf.Tree.Child("subroutineDec")
+	let := sub.Child("subroutineBody").Child("statements").Child("letStatement")
+	term := let.Child("expression").Child("term")
+	tests := []struct {
+		name string
+		node *Node
+		want string
+	}{
+		{"class, without the comments around it", sf.Tree, src[len("/** A. */\n") : len(src)-1]},
+		{"subroutine", sub, "function void f() {\n    let x = (1 + g(2)) ; // set\n  }"},
+		{"statement, without its trailing comment", let, "let x = (1 + g(2)) ;"},
+		{"nested rules", term, "(1 + g(2))"},
+		{"innermost call", term.Child("expression").ChildrenOf("term")[1], "g(2)"},
+		{"token", let.Child("identifier"), "x"},
+	}
+	for _, tt := range tests {
+		if got := spanText(sf, tt.node); got != tt.want {
+			t.Errorf("%s: span %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	// empty rules cover the empty range where their tokens would be
+	params := sub.Child("parameterList")
+	if start, end := params.Span(); start != end || src[start] != ')' {
+		t.Errorf("empty parameter list spans %d-%d, want an empty range before )", start, end)
+	}
+	empty := sf.Tree.ChildrenOf("subroutineDec")[1].Child("subroutineBody").Child("statements")
+	if start, end := empty.Span(); start != end || src[start] != '}' {
+		t.Errorf("empty statements span %d-%d, want an empty range before }", start, end)
+	}
+}
+
+func TestExplorerPage(t *testing.T) {
+	src := "class A {\n  // 😀 é\n  function void f() { do g(\"</script>\"); return; }\n}\n"
+	sf, err := parseSource("A.jack", src, TokenizerOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := explorerPage(sf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const open = `<script type="application/json" id="data">`
+	_, data, ok := strings.Cut(page, open)
+	if !ok {
+		t.Fatal("no data in the page")
+	}
+	data, _, _ = strings.Cut(data, "</script>")
+	var got struct {
+		Source string        `json:"source"`
+		Tree   *explorerNode `json:"tree"`
+	}
+	if err := json.Unmarshal([]byte(data), &got); err != nil {
+		t.Fatalf("the data does not decode, or a string closed its script element: %s", err)
+	}
+	if got.Source != src {
+		t.Errorf("source %q, want %q", got.Source, src)
+	}
+
+	// after the comment, UTF-16 offsets run 3 units short of byte offsets:
+	// 😀 takes 4 bytes for 2 units, é 2 bytes for 1 unit
+	sub := got.Tree.Children[3]
+	if sub.Kind != "subroutineDec" || sub.Children == nil {
+		t.Fatalf("fourth child of the class is %s", sub.Kind)
+	}
+	function := sub.Children[0]
+	at := strings.Index(src, "function")
+	if function.Text != "function" || function.Start != at-3 || function.End != at-3+len("function") {
+		t.Errorf("function keyword %q at %d-%d, want %d-%d", function.Text, function.Start, function.End, at-3, at-3+len("function"))
+	}
+	if function.Children != nil {
+		t.Errorf("token node has children %v", function.Children)
+	}
+	params := sub.Children[4]
+	if params.Kind != "parameterList" || params.Start != params.End || len(params.Children) != 0 {
+		t.Errorf("empty parameter list %+v", params)
+	}
+}
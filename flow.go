@@ -0,0 +1,109 @@
+package main
+
+import "strings"
+
+// flowAnalyzer follows the if/else/while structure of a subroutine body to
+// find where control can run off the end and which statements never run.
+// Jack has no break statement, so a while (true) loop only exits through a
+// return.
+type flowAnalyzer struct {
+	unreachable []*Node // first dead statement of each statement list
+	returns     []*Node // return statements control can reach
+}
+
+// statements reports whether control can reach the end of a statements node.
+func (fa *flowAnalyzer) statements(stmts *Node) bool {
+	for _, st := range stmts.children {
+		if !fa.statement(st) {
+			// whatever follows can never run
+			if next := nextSibling(st); next != nil {
+				fa.unreachable = append(fa.unreachable, next)
+			}
+			return false
+		}
+	}
+	return true
+}
+
+// statement reports whether control can continue after a statement.
+func (fa *flowAnalyzer) statement(st *Node) bool {
+	switch st.kind {
+	case "returnStatement":
+		fa.returns = append(fa.returns, st)
+		return false
+	case "ifStatement":
+		branches := st.ChildrenOf("statements")
+		thenFalls := fa.statements(branches[0])
+		if len(branches) == 1 {
+			return true
+		}
+		elseFalls := fa.statements(branches[1])
+		return thenFalls || elseFalls
+	case "whileStatement":
+		fa.statements(st.Child("statements"))
+		return !isConstantTrue(st.Child("expression"))
+	}
+	return true
+}
+
+// isConstantTrue reports whether an expression is the literal true.
+func isConstantTrue(expr *Node) bool {
+	terms := expr.ChildrenOf("term")
+	if len(terms) != 1 || len(expr.children) != 1 {
+		return false
+	}
+	tokens := terms[0].children
+	return len(tokens) == 1 && tokens[0].IsToken() && tokens[0].token.Is(KEYWORD, KwTRUE)
+}
+
+func nextSibling(n *Node) *Node {
+	siblings := n.parent.children
+	for i, c := range siblings {
+		if c == n && i+1 < len(siblings) {
+			return siblings[i+1]
+		}
+	}
+	return nil
+}
+
+func lintMissingReturn(lc *lintContext, cd *ClassDecl) {
+	for _, sd := range cd.Subroutines {
+		fa := &flowAnalyzer{}
+		if fa.statements(sd.Body.Child("statements")) {
+			lc.report("missing-return", sd.NameToken, "not every path of %s ends with a return statement", sd.Name)
+		}
+	}
+}
+
+func lintUnreachableCode(lc *lintContext, cd *ClassDecl) {
+	for _, sd := range cd.Subroutines {
+		fa := &flowAnalyzer{}
+		fa.statements(sd.Body.Child("statements"))
+		for _, st := range fa.unreachable {
+			tok, _ := st.FirstToken()
+			lc.report("unreachable-code", tok, "unreachable %s statement in %s", strings.TrimSuffix(st.kind, "Statement"), sd.Name)
+		}
+	}
+}
+
+func lintVoidReturnValue(lc *lintContext, cd *ClassDecl) {
+	for _, sd := range cd.Subroutines {
+		for _, ret := range sd.Body.Find("returnStatement") {
+			if sd.ReturnType == KwVOID && ret.Child("expression") != nil {
+				tok, _ := ret.FirstToken()
+				lc.report("void-return-value", tok, "void %s %s returns a value", sd.Kind, sd.Name)
+			}
+		}
+	}
+}
+
+func lintBareReturn(lc *lintContext, cd *ClassDecl) {
+	for _, sd := range cd.Subroutines {
+		for _, ret := range sd.Body.Find("returnStatement") {
+			if sd.ReturnType != KwVOID && ret.Child("expression") == nil {
+				tok, _ := ret.FirstToken()
+				lc.report("bare-return", tok, "%s %s must return a value of type %s", sd.Kind, sd.Name, sd.ReturnType)
+			}
+		}
+	}
+}
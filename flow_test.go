@@ -0,0 +1,71 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+// subroutineClass is a class Point with the fields x and y, a subroutine
+// declared by decl on line 3 whose body is filled in by the tests from line
+// 4, and a method getX.
+func subroutineClass(decl, body string) string {
+	return `class Point {
+	field int x, y;
+	` + decl + ` {
+` + body + `
+	}
+	method int getX() { return x; }
+}`
+}
+
+func TestMissingReturn(t *testing.T) {
+	missing := []string{"3: not every path of f ends with a return statement"}
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{"return", "return 0;", nil},
+		{"no return", "do Output.println();", missing},
+		{"if without else", "if (c) { return 1; }", missing},
+		{"both branches return", "if (c) { return 1; } else { return 2; }", nil},
+		{"one branch falls through", "if (c) { return 1; } else { let c = false; }", missing},
+		{"nested branches return", "if (c) { if (c) { return 1; } else { return 2; } } else { return 3; }", nil},
+		{"infinite loop", "while (true) { do Output.println(); }", nil},
+		{"loop that may exit", "while (c) { return 1; }", missing},
+		{"return after a loop", "while (c) { let c = false; }\n return 0;", nil},
+	}
+	for _, tt := range tests {
+		got := ruleIssues(lintProject(t, subroutineClass("function int f(boolean c)", tt.body)), "missing-return")
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: missing-return issues %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestUnreachableCode(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{"nothing dead", "if (c) { return 1; }\n return 0;", nil},
+		{"after a return", "return 0;\n do Output.println();",
+			[]string{"5: unreachable do statement in f"}},
+		{"only the first dead statement", "return 0;\n let c = c;\n let c = c;",
+			[]string{"5: unreachable let statement in f"}},
+		{"after an if whose branches return", "if (c) { return 1; } else { return 2; }\n let c = c;",
+			[]string{"5: unreachable let statement in f"}},
+		{"inside a branch", "if (c) { return 1;\n let c = c; }\n return 0;",
+			[]string{"5: unreachable let statement in f"}},
+		{"after an infinite loop", "while (true) { let c = c; }\n return 0;",
+			[]string{"5: unreachable return statement in f"}},
+		{"after a loop that may exit", "while (c) { return 1; }\n return 0;", nil},
+	}
+	for _, tt := range tests {
+		got := ruleIssues(lintProject(t, subroutineClass("function int f(boolean c)", tt.body)), "unreachable-code")
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: unreachable-code issues %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
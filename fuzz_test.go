@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fuzzOptions are the tokenizer dialects the fuzz targets pick from.
+var fuzzOptions = []TokenizerOptions{
+	{},
+	{Strict: true},
+	{StringEscapes: true, RadixLiterals: true},
+	{LenientIdentifiers: true},
+	{StringEscapes: true, RadixLiterals: true, LenientIdentifiers: true},
+}
+
+// sampleSources reads the bundled sample programs. They are valid Jack in
+// every dialect, so the fuzz targets seed from them and must accept them.
+func sampleSources(tb testing.TB) map[string]bool {
+	tb.Helper()
+	paths, err := filepath.Glob("*/*.jack")
+	if err != nil || len(paths) == 0 {
+		tb.Fatalf("no sample programs found: %v", err)
+	}
+	samples := map[string]bool{}
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		samples[string(content)] = true
+	}
+	return samples
+}
+
+// addSeeds seeds a fuzz target with every sample in every dialect.
+func addSeeds(f *testing.F, samples map[string]bool) {
+	for src := range samples {
+		for dialect := range fuzzOptions {
+			f.Add(src, uint8(dialect))
+		}
+	}
+}
+
+// diagnosticProblem checks that an error is a positioned diagnostic.
+func diagnosticProblem(err error) string {
+	var ae *AnalyzerError
+	if !errors.As(err, &ae) {
+		return fmt.Sprintf("error without position: %s", err)
+	}
+	if ae.LineNum < 1 || ae.Col < 0 {
+		return fmt.Sprintf("error at invalid position %d:%d: %s", ae.LineNum, ae.Col, err)
+	}
+	return ""
+}
+
+// checkDiagnostic fails on an error that is not a positioned diagnostic,
+// or on any error for a valid sample.
+func checkDiagnostic(t *testing.T, samples map[string]bool, src string, err error) {
+	if problem := diagnosticProblem(err); problem != "" {
+		t.Fatal(problem)
+	}
+	if samples[src] {
+		t.Fatalf("valid sample rejected: %s", err)
+	}
+}
+
+func FuzzNewTokenizer(f *testing.F) {
+	samples := sampleSources(f)
+	addSeeds(f, samples)
+	f.Fuzz(func(t *testing.T, src string, dialect uint8) {
+		tokenizer, err := NewTokenizer(src, fuzzOptions[int(dialect)%len(fuzzOptions)])
+		if err != nil {
+			checkDiagnostic(t, samples, src, err)
+			return
+		}
+		if rendered := tokenizer.Render(); rendered != src {
+			t.Fatalf("the token stream renders to %q", rendered)
+		}
+	})
+}
+
+func FuzzProcessClass(f *testing.F) {
+	samples := sampleSources(f)
+	addSeeds(f, samples)
+	f.Fuzz(func(t *testing.T, src string, dialect uint8) {
+		tokenizer, err := NewTokenizer(src, fuzzOptions[int(dialect)%len(fuzzOptions)])
+		if err != nil {
+			return
+		}
+		ce := NewCompilationEngine(tokenizer, NewXMLWriter(&bytes.Buffer{}, "  ", "\n"))
+		if err := ce.ProcessClass(); err != nil {
+			checkDiagnostic(t, samples, src, err)
+			return
+		}
+		// the consumers of the parse tree must cope with any class
+		compileClass(declareClass(ce.Tree()), true)
+	})
+}
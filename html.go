@@ -0,0 +1,355 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// sourceSpan is a run of source text rendered with one style. Title is the
+// hover text and id an anchor, both optional.
+type sourceSpan struct {
+	start, end int
+	class      string
+	title      string
+	id         string
+}
+
+// sourceMark is a diagnostic underlined in the rendered source.
+type sourceMark struct {
+	start, end int
+	severity   string // error or warning
+	msg        string
+}
+
+// highlightClasses maps token types and comment trivia to CSS classes.
+var highlightClasses = map[string]string{
+	string(KEYWORD):       "kw",
+	string(SYMBOL):        "sym",
+	string(INT_CONST):     "int",
+	string(STRING_CONST):  "str",
+	string(IDENTIFIER):    "id",
+	string(LINE_COMMENT):  "com",
+	string(BLOCK_COMMENT): "com",
+	string(DOC_COMMENT):   "com doc",
+}
+
+const highlightStyle = `body { font-family: sans-serif; margin: 0; }
+header { padding: 0.5em 1em; background: #f4f4f4; border-bottom: 1px solid #ddd; }
+header a { margin-right: 1em; }
+.diagnostics { margin: 0.5em 0 0; padding-left: 1.2em; }
+.code { font-family: monospace; white-space: pre; padding: 0.5em 0; }
+.line:target { background: #fff8c4; }
+.ln { display: inline-block; width: 4em; padding-right: 1em; text-align: right; color: #999; text-decoration: none; user-select: none; }
+.kw { color: #00c; font-weight: bold; }
+.sym { color: #555; }
+.int { color: #098658; }
+.str { color: #a31515; }
+.id { color: #001080; }
+.com { color: #008000; font-style: italic; }
+.doc { color: #3a7d44; }
+.error { text-decoration: underline wavy #e00; }
+.warning { text-decoration: underline wavy #d90; }
+`
+
+// runHTML implements the html command: every .jack file is rendered as a
+// standalone syntax-highlighted HTML page. Files that fail to tokenize or
+// parse are rendered too, with the error underlined.
+func runHTML(args []string) {
+	fs := flag.NewFlagSet("html", flag.ExitOnError)
+	var src, out string
+	var lint bool
+	fs.StringVar(&src, "s", "", "source file in jack extension or a directory with multiple jack files")
+	fs.StringVar(&out, "o", "", "output directory (default: next to the sources)")
+	fs.BoolVar(&lint, "lint", true, "also underline the issues of the lint rules")
+	opts := tokenizerFlags(fs)
+	fs.Parse(args)
+	if src == "" {
+		fmt.Println("No source file provided")
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	paths, err := listJackFiles(src)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	files := []*SourceFile{}
+	marks := map[*SourceFile][]sourceMark{}
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Printf("Error reading jack file %s: %s\n", path, err)
+			os.Exit(1)
+		}
+		sf, err := parsePartially(path, string(content), *opts)
+		files = append(files, sf)
+		if err != nil {
+			marks[sf] = append(marks[sf], errorMark(sf, err))
+		}
+	}
+
+	if lint {
+		// the rules need the declarations of every class of the project
+		parsed := []*SourceFile{}
+		for _, sf := range files {
+			if len(marks[sf]) == 0 {
+				parsed = append(parsed, sf)
+			}
+		}
+		cfg, err := loadLintConfig(projectLintConfig(src))
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		project := map[string]*ClassDecl{}
+		for _, sf := range parsed {
+			project[sf.ClassName()] = declareClass(sf.Tree)
+		}
+		for _, sf := range parsed {
+			for _, issue := range lintFile(sf, project[sf.ClassName()], project, cfg) {
+				marks[sf] = append(marks[sf], sourceMark{
+					start:    issue.Token.offset,
+					end:      issue.Token.offset + len(issue.Token.lexeme),
+					severity: "warning",
+					msg:      issue.Rule + ": " + issue.Msg,
+				})
+			}
+		}
+	}
+
+	for _, sf := range files {
+		path := strings.TrimSuffix(sf.Path, ".jack") + ".html"
+		if out != "" {
+			path = filepath.Join(out, filepath.Base(path))
+		}
+		if err := os.WriteFile(path, []byte(highlightHTML(sf, marks[sf])), 0644); err != nil {
+			fmt.Printf("Error writing html file %s: %s\n", path, err)
+			os.Exit(1)
+		}
+		fmt.Printf("Rendered %s to %s with %d diagnostics ✅\n", sf.Path, path, len(marks[sf]))
+	}
+}
+
+// parsePartially tokenizes and parses a class like parseSource, but keeps
+// what it got before an error: the tokenizer is nil when the source does
+// not tokenize, and the tree ends where the parser stopped.
+func parsePartially(path, source string, opts TokenizerOptions) (*SourceFile, error) {
+	sf := &SourceFile{Path: path, Source: source}
+	tokenizer, err := NewTokenizer(source, opts)
+	if err != nil {
+		return sf, err
+	}
+	sf.Tokenizer = tokenizer
+	ce := NewCompilationEngine(tokenizer, nil)
+	err = ce.ProcessClass()
+	sf.Tree = ce.Tree()
+	return sf, err
+}
+
+// errorMark underlines the token an error points at, or the word at its
+// position when the source did not tokenize.
+func errorMark(sf *SourceFile, err error) sourceMark {
+	mark := sourceMark{severity: "error", msg: err.Error()}
+	var ae *AnalyzerError
+	if !errors.As(err, &ae) {
+		return mark
+	}
+	mark.start = lineOffset(sf.Source, ae.LineNum) + max(ae.Col-1, 0)
+	mark.start = min(mark.start, len(sf.Source))
+	if sf.Tokenizer != nil {
+		tokens := sf.Tokenizer.Tokens()
+		i := sort.Search(len(tokens), func(i int) bool { return tokens[i].offset >= mark.start })
+		if i < len(tokens) && tokens[i].offset == mark.start {
+			mark.end = mark.start + len(tokens[i].lexeme)
+		} else if i == len(tokens) && i > 0 {
+			// errors at the end of the input point past the last token
+			last := tokens[i-1]
+			mark.start, mark.end = last.offset, last.offset+len(last.lexeme)
+		}
+	}
+	if mark.end <= mark.start {
+		// the word at the position, or its single character
+		rest := sf.Source[mark.start:]
+		n := 0
+		for n < len(rest) && isWordByte(rest[n]) {
+			n++
+		}
+		mark.end = mark.start + max(n, min(len(rest), 1))
+	}
+	return mark
+}
+
+// lineOffset returns the offset of the start of a 1-based line.
+func lineOffset(source string, line int) int {
+	offset := 0
+	for range line - 1 {
+		i := strings.IndexByte(source[offset:], '\n')
+		if i < 0 {
+			return len(source)
+		}
+		offset += i + 1
+	}
+	return offset
+}
+
+// highlightSpans splits the source into styled spans: tokens titled with
+// the grammar rules they belong to, and comments. Without a token stream
+// the source is a single plain span.
+func highlightSpans(sf *SourceFile) []sourceSpan {
+	if sf.Tokenizer == nil {
+		return []sourceSpan{{start: 0, end: len(sf.Source)}}
+	}
+	rules := map[int]string{}
+	anchors := map[int]string{}
+	if sf.Tree != nil {
+		path := []string{}
+		var walk func(n *Node)
+		walk = func(n *Node) {
+			if n.IsToken() {
+				rules[n.token.offset] = strings.Join(path, " › ")
+				return
+			}
+			path = append(path, n.kind)
+			for _, c := range n.children {
+				walk(c)
+			}
+			path = path[:len(path)-1]
+		}
+		walk(sf.Tree)
+		class := ""
+		if tokens := sf.Tree.ChildTokens(); len(tokens) > 1 {
+			class = tokens[1].tokenValue
+		}
+		for _, sub := range sf.Tree.ChildrenOf("subroutineDec") {
+			if tokens := sub.ChildTokens(); len(tokens) > 2 {
+				anchors[tokens[2].offset] = class + "." + tokens[2].tokenValue
+			}
+		}
+	}
+
+	spans := []sourceSpan{}
+	pos := 0
+	trivia := func(trs []Trivia) {
+		for _, tr := range trs {
+			spans = append(spans, sourceSpan{start: pos, end: pos + len(tr.text), class: highlightClasses[string(tr.kind)]})
+			pos += len(tr.text)
+		}
+	}
+	for _, token := range sf.Tokenizer.Tokens() {
+		trivia(token.leading)
+		title, ok := rules[token.offset]
+		if ok {
+			title = string(token.tokenType) + " in " + title
+		} else {
+			title = string(token.tokenType) + " not parsed"
+		}
+		spans = append(spans, sourceSpan{
+			start: pos,
+			end:   pos + len(token.lexeme),
+			class: highlightClasses[string(token.tokenType)],
+			title: title,
+			id:    anchors[token.offset],
+		})
+		pos += len(token.lexeme)
+		trivia(token.trailing)
+	}
+	trivia(sf.Tokenizer.eof().leading)
+	return spans
+}
+
+// highlightHTML renders a source file as a standalone HTML page with line
+// numbers, anchors on the subroutine names and the diagnostics underlined.
+func highlightHTML(sf *SourceFile, marks []sourceMark) string {
+	spans := highlightSpans(sf)
+	sort.SliceStable(marks, func(i, j int) bool { return marks[i].start < marks[j].start })
+	esc := xmlEscape
+	var sb strings.Builder
+	name := filepath.Base(sf.Path)
+	fmt.Fprintf(&sb, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n<style>\n%s</style>\n</head>\n<body>\n", esc(name), highlightStyle)
+	fmt.Fprintf(&sb, "<header>\n<b>%s</b>\n", esc(name))
+	for _, span := range spans {
+		if span.id != "" {
+			fmt.Fprintf(&sb, "<a href=\"#%s\">%s</a>\n", esc(span.id), esc(span.id))
+		}
+	}
+	if len(marks) > 0 {
+		sb.WriteString("<ul class=\"diagnostics\">\n")
+		for _, m := range marks {
+			line := strings.Count(sf.Source[:m.start], "\n") + 1
+			fmt.Fprintf(&sb, "<li class=\"%s\"><a href=\"#L%d\">line %d</a>: %s</li>\n", m.severity, line, line, esc(m.msg))
+		}
+		sb.WriteString("</ul>\n")
+	}
+	sb.WriteString("</header>\n<div class=\"code\">")
+
+	line := 0
+	newLine := func() {
+		if line > 0 {
+			sb.WriteString("</div>")
+		}
+		line++
+		fmt.Fprintf(&sb, "<div class=\"line\" id=\"L%d\"><a class=\"ln\" href=\"#L%d\">%d</a>", line, line, line)
+	}
+	newLine()
+	for _, span := range spans {
+		// a span is cut at line breaks and wherever a diagnostic starts or
+		// ends, so that each piece carries a single set of classes
+		cuts := []int{span.start, span.end}
+		for _, m := range marks {
+			for _, c := range []int{m.start, m.end} {
+				if c > span.start && c < span.end {
+					cuts = append(cuts, c)
+				}
+			}
+		}
+		sort.Ints(cuts)
+		for i := 0; i+1 < len(cuts); i++ {
+			start, end := cuts[i], cuts[i+1]
+			classes, titles := []string{}, []string{}
+			if span.class != "" {
+				classes = append(classes, span.class)
+			}
+			for _, m := range marks {
+				if m.start < end && start < m.end {
+					classes = append(classes, m.severity)
+					titles = append(titles, m.msg)
+				}
+			}
+			if span.title != "" {
+				titles = append(titles, span.title)
+			}
+			for j, text := range strings.Split(sf.Source[start:end], "\n") {
+				if j > 0 {
+					newLine()
+				}
+				text = strings.TrimSuffix(text, "\r")
+				if text == "" {
+					continue
+				}
+				if len(classes) == 0 && span.id == "" {
+					sb.WriteString(esc(text))
+					continue
+				}
+				sb.WriteString("<span")
+				if span.id != "" && start == span.start {
+					fmt.Fprintf(&sb, " id=\"%s\"", esc(span.id))
+				}
+				if len(classes) > 0 {
+					fmt.Fprintf(&sb, " class=\"%s\"", strings.Join(classes, " "))
+				}
+				if len(titles) > 0 {
+					fmt.Fprintf(&sb, " title=\"%s\"", esc(strings.Join(titles, "\n")))
+				}
+				fmt.Fprintf(&sb, ">%s</span>", esc(text))
+			}
+		}
+	}
+	sb.WriteString("</div></div>\n</body>\n</html>\n")
+	return sb.String()
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestHighlightSpans(t *testing.T) {
+	src := "// c\nclass A { }\n"
+	sf, err := parsePartially("A.jack", src, TokenizerOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, span := range highlightSpans(sf) {
+		got = append(got, src[span.start:span.end]+"|"+span.class+"|"+span.title)
+	}
+	want := []string{
+		"// c|com|",
+		"\n||",
+		"class|kw|keyword in class",
+		" ||",
+		"A|id|identifier in class",
+		" ||",
+		"{|sym|symbol in class",
+		" ||",
+		"}|sym|symbol in class",
+		"\n||",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("spans:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// a parse that stopped early leaves the rest of the tokens unparsed
+	sf, _ = parsePartially("A.jack", "class A { int }", TokenizerOptions{})
+	spans := highlightSpans(sf)
+	if last := spans[len(spans)-1]; last.title != "symbol not parsed" {
+		t.Errorf("title of a token after the error %q", last.title)
+	}
+	// without tokens the source is a single plain span
+	sf, _ = parsePartially("A.jack", "class A { \"abc }", TokenizerOptions{})
+	if spans := highlightSpans(sf); len(spans) != 1 || spans[0].end != len(sf.Source) || spans[0].class != "" {
+		t.Errorf("spans of a source that does not tokenize %+v", spans)
+	}
+}
+
+func TestErrorMark(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string // text the mark underlines
+	}{
+		{"token at the column", "class A {\n  field int x\n  field int y;\n}", "field"},
+		{"past the last token", "class A {\n  function void f() {\n    return;\n  }\n", "}"},
+		{"word where the source does not tokenize", "class A {\n  field int 12abc;\n}", "12abc"},
+		{"single character where the source does not tokenize", "class A {\n  field int x; #\n}", "#"},
+	}
+	for _, tt := range tests {
+		sf, err := parsePartially("A.jack", tt.src, TokenizerOptions{})
+		if err == nil {
+			t.Fatalf("%s: parsed", tt.name)
+		}
+		mark := errorMark(sf, err)
+		if got := tt.src[mark.start:mark.end]; got != tt.want || mark.severity != "error" {
+			t.Errorf("%s: %s mark on %q, want an error on %q", tt.name, mark.severity, got, tt.want)
+		}
+	}
+
+	// an error without position marks nothing
+	sf, _ := parsePartially("A.jack", "class A { }", TokenizerOptions{})
+	if mark := errorMark(sf, errors.New("boom")); mark.start != 0 || mark.end != 0 || mark.msg != "boom" {
+		t.Errorf("mark of an error without position %+v", mark)
+	}
+}
+
+func TestHighlightHTMLEscaping(t *testing.T) {
+	src := "/** a <b> & c */\nclass A {\n  function void f() { do g(\"<&>\"); return; } // x < y\n}\n"
+	sf, err := parsePartially("A&B.jack", src, TokenizerOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	end := len(src) - 1
+	page := highlightHTML(sf, []sourceMark{{start: end - 1, end: end, severity: "warning", msg: `"<rule>"`}})
+	for _, want := range []string{
+		"<title>A&amp;B.jack</title>",
+		`<span class="com doc">/** a &lt;b&gt; &amp; c */</span>`,
+		`<span class="str" title="stringConstant in`,
+		`>&quot;&lt;&amp;&gt;&quot;</span>`,
+		`<span class="com">// x &lt; y</span>`,
+		`title="&quot;&lt;rule&gt;&quot;`,
+		`<a href="#L4">line 4</a>: &quot;&lt;rule&gt;&quot;</li>`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("page lacks %s", want)
+		}
+	}
+	if strings.Contains(page, "<&>") || strings.Contains(page, "a <b> &") {
+		t.Error("page holds unescaped source")
+	}
+}
+
+func TestHighlightHTMLMarks(t *testing.T) {
+	src := "class A {\n  field int abc;\n}\n"
+	sf, err := parsePartially("A.jack", src, TokenizerOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the mark covers the end of field, the space and the start of int
+	start := strings.Index(src, "ld int")
+	marks := []sourceMark{{start: start, end: start + len("ld i"), severity: "warning", msg: "w"}}
+	page := highlightHTML(sf, marks)
+	_, line, _ := strings.Cut(page, `<div class="line" id="L2">`)
+	line, _, _ = strings.Cut(line, "</div>")
+	want := `<a class="ln" href="#L2">2</a>  ` +
+		`<span class="kw" title="keyword in class › classVarDec">fie</span>` +
+		`<span class="kw warning" title="w` + "\n" + `keyword in class › classVarDec">ld</span>` +
+		`<span class="warning" title="w"> </span>` +
+		`<span class="kw warning" title="w` + "\n" + `keyword in class › classVarDec">i</span>` +
+		`<span class="kw" title="keyword in class › classVarDec">nt</span> `
+	if !strings.HasPrefix(line, want) {
+		t.Errorf("line 2:\n%s\nwant it to start with:\n%s", line, want)
+	}
+}
@@ -0,0 +1,617 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Jack OS key codes of the non-printable keys.
+const (
+	keyNewLine   = 128
+	keyBackSpace = 129
+	keyLeft      = 130
+	keyUp        = 131
+	keyRight     = 132
+	keyDown      = 133
+	keyHome      = 134
+	keyEnd       = 135
+	keyPageUp    = 136
+	keyPageDown  = 137
+	keyInsert    = 138
+	keyDelete    = 139
+	keyEsc       = 140
+	keyF1        = 141
+
+	outputRows = 23
+	outputCols = 64
+)
+
+// keyNames are the special keys of a keyboard script, written in braces.
+var keyNames = map[string]int16{
+	"enter": keyNewLine, "backspace": keyBackSpace, "left": keyLeft, "up": keyUp,
+	"right": keyRight, "down": keyDown, "home": keyHome, "end": keyEnd,
+	"pageup": keyPageUp, "pagedown": keyPageDown, "insert": keyInsert,
+	"delete": keyDelete, "esc": keyEsc,
+}
+
+// parseKeyScript reads the keys typed by a scripted keyboard: every
+// character is a key press, a line break is Enter and special keys are
+// written {up}, {esc}, {f1} and so on.
+func parseKeyScript(script string) ([]int16, error) {
+	keys := []int16{}
+	for i := 0; i < len(script); i++ {
+		if script[i] == '{' {
+			if end := strings.IndexByte(script[i:], '}'); end > 0 {
+				name := strings.ToLower(script[i+1 : i+end])
+				code, ok := keyNames[name]
+				if n, err := strconv.Atoi(strings.TrimPrefix(name, "f")); strings.HasPrefix(name, "f") && err == nil && n >= 1 && n <= 12 {
+					code, ok = int16(keyF1+n-1), true
+				}
+				if ok {
+					keys = append(keys, code)
+					i += end
+					continue
+				}
+			}
+		}
+		switch c := script[i]; {
+		case c == '\r':
+		case c == '\n':
+			keys = append(keys, keyNewLine)
+		case c < ' ' || c > '~':
+			return nil, fmt.Errorf("character %q of the keyboard script has no Jack key code", c)
+		default:
+			keys = append(keys, int16(c))
+		}
+	}
+	return keys, nil
+}
+
+// JackOS implements the Jack OS classes natively: Output prints to a text
+// buffer, Screen draws into the screen memory map, Keyboard reads a script
+// and Memory manages the heap of the machine.
+type JackOS struct {
+	output   [outputRows][outputCols]byte
+	row, col int
+	color    bool // true draws black
+
+	keys    []int16
+	pressed bool // the first key of keys is held down
+
+	free      []heapBlock // sorted by address
+	allocated map[int]int // block sizes by address
+}
+
+type heapBlock struct{ addr, size int }
+
+type nativeFunc func(m *Machine, args []int16) (int16, error)
+
+// NewJackOS returns the OS with an empty screen and the keys a scripted
+// keyboard will type.
+func NewJackOS(keys []int16) *JackOS {
+	jos := &JackOS{
+		color:     true,
+		keys:      keys,
+		free:      []heapBlock{{ramHeap, ramScreen - ramHeap}},
+		allocated: map[int]int{},
+	}
+	for r := range jos.output {
+		for c := range jos.output[r] {
+			jos.output[r][c] = ' '
+		}
+	}
+	return jos
+}
+
+// Output returns the text printed through the Output class, without
+// trailing blanks.
+func (jos *JackOS) Output() string {
+	lines := make([]string, outputRows)
+	for r, row := range jos.output {
+		lines[r] = strings.TrimRight(string(row[:]), " ")
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func (jos *JackOS) native(name string) (nativeFunc, int, bool) {
+	f, ok := jackOSFunctions[name]
+	return f, jackOSArity[name], ok
+}
+
+// jackOSArity is the number of arguments of each OS subroutine, the object
+// included for methods.
+var jackOSArity = map[string]int{
+	"Sys.init": 0, "Sys.halt": 0, "Sys.wait": 1, "Sys.error": 1,
+	"Math.init": 0, "Math.abs": 1, "Math.min": 2, "Math.max": 2,
+	"Math.multiply": 2, "Math.divide": 2, "Math.sqrt": 1,
+	"Memory.init": 0, "Memory.peek": 1, "Memory.poke": 2, "Memory.alloc": 1, "Memory.deAlloc": 1,
+	"Array.new": 1, "Array.dispose": 1,
+	"String.new": 1, "String.dispose": 1, "String.length": 1, "String.charAt": 2,
+	"String.setCharAt": 3, "String.appendChar": 2, "String.eraseLastChar": 1,
+	"String.intValue": 1, "String.setInt": 2,
+	"String.newLine": 0, "String.backSpace": 0, "String.doubleQuote": 0,
+	"Output.init": 0, "Output.moveCursor": 2, "Output.printChar": 1, "Output.printString": 1,
+	"Output.printInt": 1, "Output.println": 0, "Output.backSpace": 0,
+	"Screen.init": 0, "Screen.clearScreen": 0, "Screen.setColor": 1, "Screen.drawPixel": 2,
+	"Screen.drawLine": 4, "Screen.drawRectangle": 4, "Screen.drawCircle": 3,
+	"Keyboard.init": 0, "Keyboard.keyPressed": 0, "Keyboard.readChar": 0,
+	"Keyboard.readLine": 1, "Keyboard.readInt": 1,
+}
+
+// jackOSFunctions maps the OS subroutines to their implementations; methods
+// receive the object as args[0].
+var jackOSFunctions map[string]nativeFunc
+
+func init() {
+	noop := func(m *Machine, args []int16) (int16, error) { return 0, nil }
+	jackOSFunctions = map[string]nativeFunc{
+		"Sys.init":  noop,
+		"Sys.halt":  func(m *Machine, args []int16) (int16, error) { return 0, errHalt },
+		"Sys.wait":  noop,
+		"Sys.error": func(m *Machine, args []int16) (int16, error) { return 0, fmt.Errorf("error code %d", args[0]) },
+		"Math.init": noop,
+		"Math.abs":  func(m *Machine, args []int16) (int16, error) { return max(args[0], -args[0]), nil },
+		"Math.min":  func(m *Machine, args []int16) (int16, error) { return min(args[0], args[1]), nil },
+		"Math.max":  func(m *Machine, args []int16) (int16, error) { return max(args[0], args[1]), nil },
+		"Math.multiply": func(m *Machine, args []int16) (int16, error) {
+			return args[0] * args[1], nil
+		},
+		"Math.divide": func(m *Machine, args []int16) (int16, error) {
+			if args[1] == 0 {
+				return 0, errors.New("division by zero")
+			}
+			return args[0] / args[1], nil
+		},
+		"Math.sqrt": func(m *Machine, args []int16) (int16, error) {
+			if args[0] < 0 {
+				return 0, errors.New("cannot compute the square root of a negative number")
+			}
+			r := int16(0)
+			for (int(r)+1)*(int(r)+1) <= int(args[0]) {
+				r++
+			}
+			return r, nil
+		},
+		"Memory.init":    noop,
+		"Memory.peek":    func(m *Machine, args []int16) (int16, error) { return m.peek(int(args[0])) },
+		"Memory.poke":    func(m *Machine, args []int16) (int16, error) { return 0, m.poke(int(args[0]), args[1]) },
+		"Memory.alloc":   func(m *Machine, args []int16) (int16, error) { return m.OS.alloc(int(args[0])) },
+		"Memory.deAlloc": func(m *Machine, args []int16) (int16, error) { return 0, m.OS.deAlloc(int(args[0])) },
+		"Array.new": func(m *Machine, args []int16) (int16, error) {
+			if args[0] <= 0 {
+				return 0, errors.New("array size must be positive")
+			}
+			return m.OS.alloc(int(args[0]))
+		},
+		"Array.dispose": func(m *Machine, args []int16) (int16, error) { return 0, m.OS.deAlloc(int(args[0])) },
+
+		// a String object holds its capacity, its length and the characters
+		"String.new":        stringNew,
+		"String.dispose":    func(m *Machine, args []int16) (int16, error) { return 0, m.OS.deAlloc(int(args[0])) },
+		"String.length":     func(m *Machine, args []int16) (int16, error) { return m.peek(int(args[0]) + 1) },
+		"String.charAt":     stringCharAt,
+		"String.setCharAt":  stringSetCharAt,
+		"String.appendChar": stringAppendChar,
+		"String.eraseLastChar": func(m *Machine, args []int16) (int16, error) {
+			length, err := m.peek(int(args[0]) + 1)
+			if err != nil {
+				return 0, err
+			}
+			if length == 0 {
+				return 0, errors.New("string is empty")
+			}
+			return 0, m.poke(int(args[0])+1, length-1)
+		},
+		"String.intValue": func(m *Machine, args []int16) (int16, error) {
+			s, err := m.goString(args[0])
+			return jackAtoi(s), err
+		},
+		"String.setInt": func(m *Machine, args []int16) (int16, error) {
+			return 0, m.setString(args[0], strconv.Itoa(int(args[1])))
+		},
+		"String.newLine":     func(m *Machine, args []int16) (int16, error) { return keyNewLine, nil },
+		"String.backSpace":   func(m *Machine, args []int16) (int16, error) { return keyBackSpace, nil },
+		"String.doubleQuote": func(m *Machine, args []int16) (int16, error) { return '"', nil },
+
+		"Output.init": noop,
+		"Output.moveCursor": func(m *Machine, args []int16) (int16, error) {
+			if args[0] < 0 || args[0] >= outputRows || args[1] < 0 || args[1] >= outputCols {
+				return 0, fmt.Errorf("illegal cursor location %d, %d", args[0], args[1])
+			}
+			m.OS.row, m.OS.col = int(args[0]), int(args[1])
+			return 0, nil
+		},
+		"Output.printChar": func(m *Machine, args []int16) (int16, error) { m.OS.printChar(args[0]); return 0, nil },
+		"Output.printString": func(m *Machine, args []int16) (int16, error) {
+			s, err := m.goString(args[0])
+			m.OS.print(s)
+			return 0, err
+		},
+		"Output.printInt":  func(m *Machine, args []int16) (int16, error) { m.OS.print(strconv.Itoa(int(args[0]))); return 0, nil },
+		"Output.println":   func(m *Machine, args []int16) (int16, error) { m.OS.printChar(keyNewLine); return 0, nil },
+		"Output.backSpace": func(m *Machine, args []int16) (int16, error) { m.OS.printChar(keyBackSpace); return 0, nil },
+
+		"Screen.init":        noop,
+		"Screen.clearScreen": screenClear,
+		"Screen.setColor":    func(m *Machine, args []int16) (int16, error) { m.OS.color = args[0] != 0; return 0, nil },
+		"Screen.drawPixel": func(m *Machine, args []int16) (int16, error) {
+			return 0, m.drawPixel(int(args[0]), int(args[1]))
+		},
+		"Screen.drawLine":      screenDrawLine,
+		"Screen.drawRectangle": screenDrawRectangle,
+		"Screen.drawCircle":    screenDrawCircle,
+
+		"Keyboard.init": noop,
+		"Keyboard.keyPressed": func(m *Machine, args []int16) (int16, error) {
+			key := m.OS.keyPressed()
+			m.RAM[ramKeyboard] = key
+			return key, nil
+		},
+		"Keyboard.readChar": keyboardReadChar,
+		"Keyboard.readLine": keyboardReadLine,
+		"Keyboard.readInt": func(m *Machine, args []int16) (int16, error) {
+			s, err := keyboardReadLine(m, args)
+			if err != nil {
+				return 0, err
+			}
+			line, err := m.goString(s)
+			if err != nil {
+				return 0, err
+			}
+			// the line is only read here, its String is not handed out
+			return jackAtoi(line), m.OS.deAlloc(int(s))
+		},
+	}
+}
+
+func (m *Machine) peek(addr int) (int16, error) {
+	addr, err := m.checkAddress(addr)
+	return m.RAM[addr], err
+}
+
+func (m *Machine) poke(addr int, v int16) error {
+	addr, err := m.checkAddress(addr)
+	if err == nil {
+		m.RAM[addr] = v
+	}
+	return err
+}
+
+// alloc hands out the first free heap block large enough, first fit.
+func (jos *JackOS) alloc(size int) (int16, error) {
+	if size <= 0 {
+		return 0, errors.New("allocated memory size must be positive")
+	}
+	for i, b := range jos.free {
+		if b.size < size {
+			continue
+		}
+		if b.size == size {
+			jos.free = slices.Delete(jos.free, i, i+1)
+		} else {
+			jos.free[i] = heapBlock{b.addr + size, b.size - size}
+		}
+		jos.allocated[b.addr] = size
+		return int16(b.addr), nil
+	}
+	return 0, fmt.Errorf("heap overflow allocating %d words", size)
+}
+
+// deAlloc returns a block to the free list, merging it with its free
+// neighbours.
+func (jos *JackOS) deAlloc(addr int) error {
+	size, ok := jos.allocated[addr]
+	if !ok {
+		return fmt.Errorf("address %d was not allocated", addr)
+	}
+	delete(jos.allocated, addr)
+	i, _ := slices.BinarySearchFunc(jos.free, addr, func(b heapBlock, addr int) int { return b.addr - addr })
+	jos.free = slices.Insert(jos.free, i, heapBlock{addr, size})
+	if i+1 < len(jos.free) && jos.free[i].addr+jos.free[i].size == jos.free[i+1].addr {
+		jos.free[i].size += jos.free[i+1].size
+		jos.free = slices.Delete(jos.free, i+1, i+2)
+	}
+	if i > 0 && jos.free[i-1].addr+jos.free[i-1].size == jos.free[i].addr {
+		jos.free[i-1].size += jos.free[i].size
+		jos.free = slices.Delete(jos.free, i, i+1)
+	}
+	return nil
+}
+
+func stringNew(m *Machine, args []int16) (int16, error) {
+	if args[0] < 0 {
+		return 0, errors.New("maximum length must be non-negative")
+	}
+	s, err := m.OS.alloc(int(args[0]) + 2)
+	if err != nil {
+		return 0, err
+	}
+	m.RAM[s], m.RAM[s+1] = args[0], 0
+	return s, nil
+}
+
+func stringCharAt(m *Machine, args []int16) (int16, error) {
+	length, err := m.peek(int(args[0]) + 1)
+	if err != nil {
+		return 0, err
+	}
+	if args[1] < 0 || args[1] >= length {
+		return 0, fmt.Errorf("string index %d out of bounds", args[1])
+	}
+	return m.peek(int(args[0]) + 2 + int(args[1]))
+}
+
+func stringSetCharAt(m *Machine, args []int16) (int16, error) {
+	if _, err := stringCharAt(m, args[:2]); err != nil {
+		return 0, err
+	}
+	return 0, m.poke(int(args[0])+2+int(args[1]), args[2])
+}
+
+func stringAppendChar(m *Machine, args []int16) (int16, error) {
+	s := int(args[0])
+	capacity, err := m.peek(s)
+	if err != nil {
+		return 0, err
+	}
+	length, err := m.peek(s + 1)
+	if err != nil {
+		return 0, err
+	}
+	if length >= capacity {
+		return 0, errors.New("string is full")
+	}
+	m.RAM[s+1] = length + 1
+	return args[0], m.poke(s+2+int(length), args[1])
+}
+
+// goString reads a String object.
+func (m *Machine) goString(s int16) (string, error) {
+	length, err := m.peek(int(s) + 1)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	for i := range int(length) {
+		c, err := m.peek(int(s) + 2 + i)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteByte(byte(c))
+	}
+	return sb.String(), nil
+}
+
+// setString replaces the contents of a String object.
+func (m *Machine) setString(s int16, text string) error {
+	capacity, err := m.peek(int(s))
+	if err != nil {
+		return err
+	}
+	if len(text) > int(capacity) {
+		return errors.New("string capacity too small")
+	}
+	m.RAM[s+1] = int16(len(text))
+	for i := range len(text) {
+		if err := m.poke(int(s)+2+i, int16(text[i])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newString allocates a String object holding text.
+func (m *Machine) newString(text string) (int16, error) {
+	s, err := stringNew(m, []int16{int16(len(text))})
+	if err != nil {
+		return 0, err
+	}
+	return s, m.setString(s, text)
+}
+
+// jackAtoi reads the leading integer of a string, like String.intValue.
+func jackAtoi(s string) int16 {
+	n, neg := int16(0), strings.HasPrefix(s, "-")
+	for _, c := range strings.TrimPrefix(s, "-") {
+		if c < '0' || c > '9' {
+			break
+		}
+		n = n*10 + int16(c-'0')
+	}
+	if neg {
+		return -n
+	}
+	return n
+}
+
+func (jos *JackOS) print(s string) {
+	for i := range len(s) {
+		jos.printChar(int16(s[i]))
+	}
+}
+
+// printChar writes a character at the cursor; lines wrap at the right
+// edge and the cursor returns to the top after the last row.
+func (jos *JackOS) printChar(c int16) {
+	switch c {
+	case keyNewLine:
+		jos.row, jos.col = (jos.row+1)%outputRows, 0
+		return
+	case keyBackSpace:
+		if jos.col > 0 {
+			jos.col--
+		} else if jos.row > 0 {
+			jos.row, jos.col = jos.row-1, outputCols-1
+		}
+		jos.output[jos.row][jos.col] = ' '
+		return
+	}
+	if c < ' ' || c > '~' {
+		c = '?'
+	}
+	jos.output[jos.row][jos.col] = byte(c)
+	if jos.col++; jos.col == outputCols {
+		jos.printChar(keyNewLine)
+	}
+}
+
+// keyPressed reports each scripted key for one call, then no key for one
+// call, so that programs waiting for a key to be released go on.
+func (jos *JackOS) keyPressed() int16 {
+	if len(jos.keys) == 0 {
+		return 0
+	}
+	if jos.pressed {
+		jos.pressed = false
+		jos.keys = jos.keys[1:]
+		return 0
+	}
+	jos.pressed = true
+	return jos.keys[0]
+}
+
+// nextKey waits for a full key press and release.
+func (jos *JackOS) nextKey() (int16, error) {
+	if jos.pressed {
+		jos.pressed = false
+		jos.keys = jos.keys[1:]
+	}
+	if len(jos.keys) == 0 {
+		return 0, errors.New("the keyboard script is exhausted")
+	}
+	key := jos.keys[0]
+	jos.keys = jos.keys[1:]
+	return key, nil
+}
+
+func keyboardReadChar(m *Machine, args []int16) (int16, error) {
+	key, err := m.OS.nextKey()
+	if err != nil {
+		return 0, err
+	}
+	m.OS.printChar(key)
+	return key, nil
+}
+
+// keyboardReadLine prints the message, then echoes keys until Enter,
+// honouring backspace, and returns the line as a new String.
+func keyboardReadLine(m *Machine, args []int16) (int16, error) {
+	message, err := m.goString(args[0])
+	if err != nil {
+		return 0, err
+	}
+	m.OS.print(message)
+	line := []byte{}
+	for {
+		key, err := m.OS.nextKey()
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case key == keyNewLine:
+			m.OS.printChar(keyNewLine)
+			return m.newString(string(line))
+		case key == keyBackSpace:
+			if len(line) > 0 {
+				line = line[:len(line)-1]
+				m.OS.printChar(keyBackSpace)
+			}
+		case key < keyNewLine:
+			line = append(line, byte(key))
+			m.OS.printChar(key)
+		}
+	}
+}
+
+func screenClear(m *Machine, args []int16) (int16, error) {
+	for addr := ramScreen; addr < ramKeyboard; addr++ {
+		m.RAM[addr] = 0
+	}
+	return 0, nil
+}
+
+func (m *Machine) drawPixel(x, y int) error {
+	if x < 0 || x >= screenWidth || y < 0 || y >= screenHeight {
+		return fmt.Errorf("illegal pixel coordinates %d, %d", x, y)
+	}
+	addr, bit := ramScreen+y*screenWidth/16+x/16, int16(1)<<(x%16)
+	if m.OS.color {
+		m.RAM[addr] |= bit
+	} else {
+		m.RAM[addr] &^= bit
+	}
+	return nil
+}
+
+func screenDrawLine(m *Machine, args []int16) (int16, error) {
+	x1, y1, x2, y2 := int(args[0]), int(args[1]), int(args[2]), int(args[3])
+	dx, dy := max(x2-x1, x1-x2), -max(y2-y1, y1-y2)
+	sx, sy := 1, 1
+	if x1 > x2 {
+		sx = -1
+	}
+	if y1 > y2 {
+		sy = -1
+	}
+	// Bresenham's algorithm
+	for diff := dx + dy; ; {
+		if err := m.drawPixel(x1, y1); err != nil {
+			return 0, err
+		}
+		if x1 == x2 && y1 == y2 {
+			return 0, nil
+		}
+		if 2*diff >= dy {
+			diff += dy
+			x1 += sx
+		}
+		if 2*diff <= dx {
+			diff += dx
+			y1 += sy
+		}
+	}
+}
+
+func screenDrawRectangle(m *Machine, args []int16) (int16, error) {
+	x1, y1, x2, y2 := int(args[0]), int(args[1]), int(args[2]), int(args[3])
+	if x1 > x2 || y1 > y2 {
+		return 0, fmt.Errorf("illegal rectangle %d, %d, %d, %d", x1, y1, x2, y2)
+	}
+	for y := y1; y <= y2; y++ {
+		for x := x1; x <= x2; x++ {
+			if err := m.drawPixel(x, y); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return 0, nil
+}
+
+// screenDrawCircle fills a circle with horizontal lines.
+func screenDrawCircle(m *Machine, args []int16) (int16, error) {
+	cx, cy, r := int(args[0]), int(args[1]), int(args[2])
+	if r < 0 || r > 181 {
+		return 0, fmt.Errorf("illegal radius %d", r)
+	}
+	for dy := -r; dy <= r; dy++ {
+		dx := 0
+		for (dx+1)*(dx+1)+dy*dy <= r*r {
+			dx++
+		}
+		for x := cx - dx; x <= cx+dx; x++ {
+			if err := m.drawPixel(x, cy+dy); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return 0, nil
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// LintIssue is a problem reported by a lint rule.
+type LintIssue struct {
+	Rule  string
+	Token Token
+	Msg   string
+}
+
+// LintConfig is the lint configuration, read from a JSON file such as
+//
+//	{"rules": {"method-without-this": false}, "maxStatements": 30}
+//
+// Rules missing from the map keep their default state.
+type LintConfig struct {
+	Rules         map[string]bool `json:"rules"`
+	MaxStatements int             `json:"maxStatements"`
+}
+
+const (
+	lintConfigFile       = ".jacklint.json"
+	defaultMaxStatements = 50
+)
+
+type lintRule struct {
+	name        string
+	description string
+	check       func(lc *lintContext, cd *ClassDecl)
+}
+
+var (
+	lintRules = []lintRule{
+		{"unused-var", "local variables that are never read", lintUnusedVars},
+		{"unused-param", "parameters that are never read", lintUnusedParams},
+		{"unused-field", "field and static variables that are never read", lintUnusedFields},
+		{"method-without-this", "methods that never use this and could be functions", lintMethodWithoutThis},
+		{"long-subroutine", "subroutines with more statements than maxStatements", lintLongSubroutine},
+		{"empty-block", "if, else and while statements with an empty body", lintEmptyBlock},
+		{"missing-return", "subroutines where some path does not end with a return statement", lintMissingReturn},
+		{"unreachable-code", "statements that follow a return on every path", lintUnreachableCode},
+		{"void-return-value", "void subroutines returning a value", lintVoidReturnValue},
+		{"bare-return", "non-void subroutines returning without a value", lintBareReturn},
+		{"constructor-type", "constructors whose return type is not their class", lintConstructorType},
+		{"constructor-return", "constructors where some path does not end with return this", lintConstructorReturn},
+		{"field-init", "fields read by a constructor before they are initialized", lintFieldInit},
+		{"constructor-call", "calls to a project constructor that match no constructor signature", lintConstructorCall},
+	}
+	lintIgnoreRgx = regexp.MustCompile(`jacklint:ignore\b([\w\-, ]*)`)
+)
+
+type lintContext struct {
+	cfg     LintConfig
+	project map[string]*ClassDecl // every class of the project, by name
+	issues  []LintIssue
+}
+
+func (lc *lintContext) report(rule string, tok Token, msg string, args ...any) {
+	lc.issues = append(lc.issues, LintIssue{Rule: rule, Token: tok, Msg: fmt.Sprintf(msg, args...)})
+}
+
+// enabled reports whether a rule is switched on; every rule is by default.
+func (cfg LintConfig) enabled(rule string) bool {
+	on, ok := cfg.Rules[rule]
+	return !ok || on
+}
+
+// runLint implements the lint command.
+func runLint(args []string) {
+	fs := flag.NewFlagSet("lint", flag.ExitOnError)
+	var src, configFile, enable, disable string
+	var maxStatements int
+	var listRules bool
+	fs.StringVar(&src, "s", "", "source file in jack extension or a directory with multiple jack files")
+	fs.StringVar(&configFile, "config", "", "lint configuration file (default "+lintConfigFile+" next to the sources, if present)")
+	fs.StringVar(&enable, "enable", "", "comma separated rules to enable")
+	fs.StringVar(&disable, "disable", "", "comma separated rules to disable")
+	fs.IntVar(&maxStatements, "max-statements", 0, "statement limit for long-subroutine (default 50)")
+	fs.BoolVar(&listRules, "rules", false, "list the available rules and exit")
+	opts := tokenizerFlags(fs)
+	fs.Parse(args)
+	if listRules {
+		for _, rule := range lintRules {
+			fmt.Printf("%-20s %s\n", rule.name, rule.description)
+		}
+		return
+	}
+	if src == "" {
+		fmt.Println("No source file provided")
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	if configFile == "" {
+		configFile = projectLintConfig(src)
+	}
+	cfg, err := loadLintConfig(configFile)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	for _, list := range []struct {
+		rules string
+		on    bool
+	}{{enable, true}, {disable, false}} {
+		for _, rule := range splitList(list.rules) {
+			if !isLintRule(rule) {
+				fmt.Printf("Unknown lint rule %s\n", rule)
+				os.Exit(1)
+			}
+			cfg.Rules[rule] = list.on
+		}
+	}
+	if maxStatements > 0 {
+		cfg.MaxStatements = maxStatements
+	}
+
+	files := loadProject(src, *opts)
+	project := map[string]*ClassDecl{}
+	for _, sf := range files {
+		project[sf.ClassName()] = declareClass(sf.Tree)
+	}
+	total := 0
+	for _, sf := range files {
+		for _, issue := range lintFile(sf, project[sf.ClassName()], project, cfg) {
+			fmt.Printf("%s:%d:%d: %s: %s\n", sf.Path, issue.Token.lineNum, issue.Token.colNum, issue.Rule, issue.Msg)
+			total++
+		}
+	}
+	if total > 0 {
+		fmt.Printf("%d lint issues found\n", total)
+		os.Exit(1)
+	}
+	fmt.Println("No lint issues found ✅")
+}
+
+// projectLintConfig returns the lint configuration file next to the sources,
+// or "" when there is none.
+func projectLintConfig(src string) string {
+	_, dir := projectName(src)
+	if _, err := os.Stat(filepath.Join(dir, lintConfigFile)); err != nil {
+		return ""
+	}
+	return filepath.Join(dir, lintConfigFile)
+}
+
+func loadLintConfig(path string) (LintConfig, error) {
+	cfg := LintConfig{Rules: map[string]bool{}, MaxStatements: defaultMaxStatements}
+	if path == "" {
+		return cfg, nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("Error reading lint config %s: %s", path, err)
+	}
+	if err := json.Unmarshal(content, &cfg); err != nil {
+		return cfg, fmt.Errorf("Error parsing lint config %s: %s", path, err)
+	}
+	if cfg.Rules == nil {
+		cfg.Rules = map[string]bool{}
+	}
+	for rule := range cfg.Rules {
+		if !isLintRule(rule) {
+			return cfg, fmt.Errorf("Unknown lint rule %s in %s", rule, path)
+		}
+	}
+	if cfg.MaxStatements <= 0 {
+		cfg.MaxStatements = defaultMaxStatements
+	}
+	return cfg, nil
+}
+
+func isLintRule(name string) bool {
+	for _, rule := range lintRules {
+		if rule.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func splitList(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' })
+}
+
+// lintFile runs the enabled rules over a parsed file and drops the issues
+// suppressed by `// jacklint:ignore RULE` comments.
+func lintFile(sf *SourceFile, cd *ClassDecl, project map[string]*ClassDecl, cfg LintConfig) []LintIssue {
+	lc := &lintContext{cfg: cfg, project: project}
+	for _, rule := range lintRules {
+		if cfg.enabled(rule.name) {
+			rule.check(lc, cd)
+		}
+	}
+	ignored := lintSuppressions(sf.Tokenizer)
+	issues := []LintIssue{}
+	for _, issue := range lc.issues {
+		rules, ok := ignored[issue.Token.lineNum]
+		if ok && (len(rules) == 0 || rules[issue.Rule]) {
+			continue
+		}
+		issues = append(issues, issue)
+	}
+	sort.SliceStable(issues, func(i, j int) bool { return issues[i].Token.offset < issues[j].Token.offset })
+	return issues
+}
+
+// lintSuppressions maps source lines to the rules ignored on them; an empty
+// set ignores every rule. A suppression comment trailing code applies to its
+// own line, one on a line of its own to the next line of code.
+func lintSuppressions(t *Tokenizer) map[int]map[string]bool {
+	ignored := map[int]map[string]bool{}
+	suppress := func(line int, comments []Trivia) {
+		for _, tr := range comments {
+			if tr.kind != LINE_COMMENT && tr.kind != BLOCK_COMMENT {
+				continue
+			}
+			m := lintIgnoreRgx.FindStringSubmatch(tr.text)
+			if m == nil {
+				continue
+			}
+			if ignored[line] == nil {
+				ignored[line] = map[string]bool{}
+			}
+			for _, rule := range splitList(m[1]) {
+				ignored[line][rule] = true
+			}
+		}
+	}
+	for _, token := range t.Tokens() {
+		suppress(token.lineNum, token.leading)
+		suppress(token.lineNum, token.trailing)
+	}
+	return ignored
+}
+
+// readVars counts the reads of every variable declared in or visible from
+// the class.
+func readVars(cd *ClassDecl) map[*VarDecl]int {
+	reads := map[*VarDecl]int{}
+	for _, sd := range cd.Subroutines {
+		for _, ref := range cd.References(sd) {
+			if ref.Kind == RefVar && ref.Var != nil && !ref.Write {
+				reads[ref.Var]++
+			}
+		}
+	}
+	return reads
+}
+
+func lintUnusedVars(lc *lintContext, cd *ClassDecl) {
+	reads := readVars(cd)
+	for _, sd := range cd.Subroutines {
+		for i := range sd.Locals {
+			if v := &sd.Locals[i]; reads[v] == 0 {
+				lc.report("unused-var", v.Token, "local variable %s is never read", v.Name)
+			}
+		}
+	}
+}
+
+func lintUnusedParams(lc *lintContext, cd *ClassDecl) {
+	reads := readVars(cd)
+	for _, sd := range cd.Subroutines {
+		for i := range sd.Params {
+			if v := &sd.Params[i]; reads[v] == 0 {
+				lc.report("unused-param", v.Token, "parameter %s of %s is never read", v.Name, sd.Name)
+			}
+		}
+	}
+}
+
+func lintUnusedFields(lc *lintContext, cd *ClassDecl) {
+	reads := readVars(cd)
+	for i := range cd.Vars {
+		if v := &cd.Vars[i]; reads[v] == 0 {
+			lc.report("unused-field", v.Token, "%s %s is never read", v.Kind, v.Name)
+		}
+	}
+}
+
+func lintMethodWithoutThis(lc *lintContext, cd *ClassDecl) {
+	for _, sd := range cd.Subroutines {
+		if sd.Kind != KwMETHOD || usesThis(cd, sd) {
+			continue
+		}
+		lc.report("method-without-this", sd.NameToken, "method %s never uses this and could be a function", sd.Name)
+	}
+}
+
+// usesThis reports whether a subroutine touches the current object: through
+// the this keyword, a field, or an unqualified call to a method.
+func usesThis(cd *ClassDecl, sd *SubroutineDecl) bool {
+	for _, tok := range sd.Body.Tokens() {
+		if tok.Is(KEYWORD, KwTHIS) {
+			return true
+		}
+	}
+	for _, ref := range cd.References(sd) {
+		switch {
+		case ref.Kind == RefVar && ref.Var != nil && ref.Var.Kind == KwFIELD:
+			return true
+		case ref.Kind == RefSubroutine && ref.Implicit:
+			if callee := cd.Subroutine(ref.Token.tokenValue); callee == nil || callee.Kind == KwMETHOD {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func lintLongSubroutine(lc *lintContext, cd *ClassDecl) {
+	for _, sd := range cd.Subroutines {
+		if n := countStatements(sd.Body); n > lc.cfg.MaxStatements {
+			lc.report("long-subroutine", sd.NameToken, "%s has %d statements, more than %d", sd.Name, n, lc.cfg.MaxStatements)
+		}
+	}
+}
+
+// countStatements counts the statements under a node, nested ones included.
+func countStatements(node *Node) int {
+	n := 0
+	node.Walk(func(c *Node) bool {
+		if strings.HasSuffix(c.kind, "Statement") {
+			n++
+		}
+		return true
+	})
+	return n
+}
+
+func lintEmptyBlock(lc *lintContext, cd *ClassDecl) {
+	for _, sd := range cd.Subroutines {
+		sd.Body.Walk(func(n *Node) bool {
+			if n.kind != "ifStatement" && n.kind != "whileStatement" {
+				return true
+			}
+			tokens := n.ChildTokens()
+			for i, body := range n.ChildrenOf("statements") {
+				if len(body.children) > 0 {
+					continue
+				}
+				at := tokens[0]
+				if i == 1 {
+					// on the else keyword, where a suppression comment goes
+					at = tokens[slices.IndexFunc(tokens, func(tok Token) bool { return tok.Is(KEYWORD, KwELSE) })]
+				}
+				lc.report("empty-block", at, "empty %s body", at.tokenValue)
+			}
+			return true
+		})
+	}
+}
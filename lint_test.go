@@ -0,0 +1,246 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// declareProject parses the classes of a project and declares them.
+func declareProject(t *testing.T, srcs ...string) ([]*SourceFile, []*ClassDecl) {
+	t.Helper()
+	files := []*SourceFile{}
+	classes := []*ClassDecl{}
+	for _, src := range srcs {
+		sf, err := parseSource("A.jack", src, TokenizerOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, sf)
+		classes = append(classes, declareClass(sf.Tree))
+	}
+	return files, classes
+}
+
+// lintProject lints the classes of a project with the default
+// configuration.
+func lintProject(t *testing.T, srcs ...string) []LintIssue {
+	t.Helper()
+	cfg, _ := loadLintConfig("")
+	return lintProjectWith(t, cfg, srcs...)
+}
+
+// lintProjectWith lints the classes of a project with cfg.
+func lintProjectWith(t *testing.T, cfg LintConfig, srcs ...string) []LintIssue {
+	t.Helper()
+	files, classes := declareProject(t, srcs...)
+	project := map[string]*ClassDecl{}
+	for _, cd := range classes {
+		project[cd.Name] = cd
+	}
+	issues := []LintIssue{}
+	for i, sf := range files {
+		issues = append(issues, lintFile(sf, classes[i], project, cfg)...)
+	}
+	return issues
+}
+
+// ruleIssues formats the issues of one rule as "line: message".
+func ruleIssues(issues []LintIssue, rule string) []string {
+	found := []string{}
+	for _, issue := range issues {
+		if issue.Rule == rule {
+			found = append(found, fmt.Sprintf("%d: %s", issue.Token.lineNum, issue.Msg))
+		}
+	}
+	return found
+}
+
+func TestLintEmptyElse(t *testing.T) {
+	tests := []struct {
+		elseLine string
+		want     []string
+	}{
+		{"else {", []string{"6: empty else body"}},
+		{"else { // jacklint:ignore empty-block", nil},
+	}
+	for _, tt := range tests {
+		src := `class A {
+	function void f() {
+		if (true) {
+			do Output.printInt(1);
+		}
+		` + tt.elseLine + `
+		}
+		return;
+	}
+}`
+		if got := ruleIssues(lintProject(t, src), "empty-block"); !slices.Equal(got, tt.want) {
+			t.Errorf("%q: empty-block issues %q, want %q", tt.elseLine, got, tt.want)
+		}
+	}
+}
+
+func TestLintUnused(t *testing.T) {
+	src := `class A {
+	field int used, unused;
+	static Array cells;
+	function void f(int a, int b, int i) {
+		var int x, y;
+		var Array arr;
+		let x = a;
+		let arr[i] = 1;
+		let cells[0] = arr;
+		return;
+	}
+	method int g() { return used; }
+}`
+	issues := lintProject(t, src)
+	tests := []struct {
+		rule string
+		want []string
+	}{
+		// writing an element reads the array and the index
+		{"unused-var", []string{"5: local variable x is never read", "5: local variable y is never read"}},
+		{"unused-param", []string{"4: parameter b of f is never read"}},
+		{"unused-field", []string{"2: field unused is never read"}},
+	}
+	for _, tt := range tests {
+		if got := ruleIssues(issues, tt.rule); !slices.Equal(got, tt.want) {
+			t.Errorf("%s issues %q, want %q", tt.rule, got, tt.want)
+		}
+	}
+}
+
+func TestLintMethodWithoutThis(t *testing.T) {
+	src := `class A {
+	field int x;
+	method int getX() { return x; }
+	method A self() { return this; }
+	method int call() { return getX(); }
+	method int callFunction() { return A.make(); }
+	method int calc(int a) { return a + 1; }
+	method void plain() { do helper(); return; }
+	function int helper() { return 0; }
+	function int make() { return 1; }
+}`
+	got := ruleIssues(lintProject(t, src), "method-without-this")
+	want := []string{
+		"6: method callFunction never uses this and could be a function",
+		"7: method calc never uses this and could be a function",
+		"8: method plain never uses this and could be a function",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("method-without-this issues %q, want %q", got, want)
+	}
+}
+
+func TestLintLongSubroutine(t *testing.T) {
+	src := `class A {
+	function void f(boolean c) {
+		if (c) { do Output.println(); }
+		while (c) { let c = false; }
+		return;
+	}
+}`
+	tests := []struct {
+		max  int
+		want []string
+	}{
+		{5, nil},
+		{4, []string{"2: f has 5 statements, more than 4"}},
+		{1, []string{"2: f has 5 statements, more than 1"}},
+	}
+	for _, tt := range tests {
+		cfg, _ := loadLintConfig("")
+		cfg.MaxStatements = tt.max
+		if got := ruleIssues(lintProjectWith(t, cfg, src), "long-subroutine"); !slices.Equal(got, tt.want) {
+			t.Errorf("maxStatements %d: long-subroutine issues %q, want %q", tt.max, got, tt.want)
+		}
+	}
+}
+
+func TestLoadLintConfig(t *testing.T) {
+	src := `class A {
+	method void f() { var int x; return; }
+}`
+	tests := []struct {
+		config string
+		rules  []string // rules reporting an issue
+		err    string
+	}{
+		{`{}`, []string{"method-without-this", "unused-var"}, ""},
+		{`{"rules": {"unused-var": false}}`, []string{"method-without-this"}, ""},
+		{`{"rules": {"unused-var": true, "method-without-this": false}}`, []string{"unused-var"}, ""},
+		{`{"maxStatements": 0}`, []string{"method-without-this", "unused-var"}, ""},
+		{`{"rules": {"no-such-rule": false}}`, nil, "Unknown lint rule no-such-rule in "},
+		{`{"rules": [}`, nil, "Error parsing lint config "},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, lintConfigFile), []byte(tt.config), 0644); err != nil {
+			t.Fatal(err)
+		}
+		path := projectLintConfig(dir)
+		if path != filepath.Join(dir, lintConfigFile) {
+			t.Fatalf("config of %s found at %q", dir, path)
+		}
+		cfg, err := loadLintConfig(path)
+		if tt.err != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+				t.Errorf("%s: error %v, want %q", tt.config, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %s", tt.config, err)
+		}
+		if cfg.MaxStatements != defaultMaxStatements {
+			t.Errorf("%s: maxStatements %d, want the default", tt.config, cfg.MaxStatements)
+		}
+		got := []string{}
+		for _, issue := range lintProjectWith(t, cfg, src) {
+			got = append(got, issue.Rule)
+		}
+		if !slices.Equal(got, tt.rules) {
+			t.Errorf("%s: issues of %q, want %q", tt.config, got, tt.rules)
+		}
+	}
+	if path := projectLintConfig(t.TempDir()); path != "" {
+		t.Errorf("config found at %q in an empty directory", path)
+	}
+}
+
+func TestLintIgnore(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []string // rules reporting an issue
+	}{
+		{"not ignored", "var int x, y;", []string{"unused-var", "unused-var"}},
+		{"trailing comment", "var int x, y; // jacklint:ignore", nil},
+		{"comment on the line before", "// jacklint:ignore unused-var\n\t\tvar int x, y;", nil},
+		{"block comment on the line before", "/* jacklint:ignore unused-var */\n\t\tvar int x, y;", nil},
+		{"another rule", "// jacklint:ignore empty-block\n\t\tvar int x, y;", []string{"unused-var", "unused-var"}},
+		{"only the next line", "// jacklint:ignore\n\t\tvar int x;\n\t\tvar int y;", []string{"unused-var"}},
+		{"several rules", "var int x, y; // jacklint:ignore empty-block, unused-var", nil},
+	}
+	for _, tt := range tests {
+		src := `class A {
+	function void f() {
+		` + tt.body + `
+		return;
+	}
+}`
+		got := []string{}
+		for _, issue := range lintProject(t, src) {
+			got = append(got, issue.Rule)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: issues of %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
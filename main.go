@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -11,66 +12,68 @@ import (
 	"sync"
 )
 
+// commands maps sub-command names to their entry points. Without a
+// sub-command the analyzer writes the token and parse tree XML files.
+var commands = map[string]func(args []string){
+	"doc":      runDoc,
+	"lint":     runLint,
+	"graph":    runGraph,
+	"metrics":  runMetrics,
+	"rename":   runRename,
+	"repl":     runRepl,
+	"compile":  runCompile,
+	"run":      runRun,
+	"html":     runHTML,
+	"explore":  runExplore,
+	"coverage": runCoverage,
+}
+
 func main() {
-	var jackSrcFiles, cmpFile string
-	flag.StringVar(&jackSrcFiles, "s", "", "source file in jack extension (e.g. Add.jack or a Directory with multiple jack files)")
-	flag.StringVar(&cmpFile, "c", "", "compare file in xml extension (e.g. Add.xml)")
-	flag.Parse()
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			cmd(os.Args[2:])
+			return
+		}
+	}
+
+	jackSrcFiles, opts, err := parseAnalyzeFlags(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
 	if jackSrcFiles == "" {
 		fmt.Println("No source file provided")
 		flag.Usage()
 		os.Exit(1)
 	}
-	// check if the source is a directory
-	srcStat, err := os.Stat(jackSrcFiles)
+
+	jackFilePaths, err := listJackFiles(jackSrcFiles)
 	if err != nil {
-		fmt.Println("Error getting source file status", err)
+		fmt.Println(err)
 		os.Exit(1)
 	}
-
 	jackFiles := []*os.File{}
 	defer func() {
 		for _, f := range jackFiles {
 			f.Close()
 		}
 	}()
-
-	if srcStat.IsDir() {
-		// get all jack files in the directory
-		rawJackFiles, err := filepath.Glob(filepath.Join(jackSrcFiles, "*.jack"))
-		if err != nil {
-			fmt.Printf("Error listing jack files %s: %s\n", jackSrcFiles, err)
-			os.Exit(1)
-		}
-		for _, jackFile := range rawJackFiles {
-			srcF, err := os.Open(jackFile)
-			if err != nil {
-				fmt.Printf("Error opening jack file %s: %s\n", jackFile, err)
-				os.Exit(1)
-			}
-			jackFiles = append(jackFiles, srcF)
-		}
-	} else {
-		srcF, err := os.Open(jackSrcFiles)
+	for _, jackFile := range jackFilePaths {
+		srcF, err := os.Open(jackFile)
 		if err != nil {
-			fmt.Printf("Error opening jack file %s: %s\n", jackSrcFiles, err)
+			fmt.Printf("Error opening jack file %s: %s\n", jackFile, err)
 			os.Exit(1)
 		}
 		jackFiles = append(jackFiles, srcF)
 	}
 
-	if len(jackFiles) == 0 {
-		fmt.Printf("No jack files found in %s\n", jackSrcFiles)
-		os.Exit(1)
-	}
-
 	// run the process in parallel
 	wg := sync.WaitGroup{}
 	for _, jackFile := range jackFiles {
 		wg.Add(1)
 		go func(jackFile *os.File) {
 			defer wg.Done()
-			processJackFile(jackFile)
+			processJackFile(jackFile, opts)
 		}(jackFile)
 	}
 	wg.Wait()
@@ -78,19 +81,102 @@ func main() {
 	fmt.Printf("Analysis complete for %d files ✅\n", len(jackFiles))
 }
 
-func processJackFile(jackFile *os.File) {
+// parseAnalyzeFlags parses the flags of the default analysis and returns
+// its source argument and options.
+func parseAnalyzeFlags(fs *flag.FlagSet, args []string) (string, analyzeOptions, error) {
+	var jackSrcFiles, cmpFile string
+	fs.StringVar(&jackSrcFiles, "s", "", "source file in jack extension (e.g. Add.jack or a Directory with multiple jack files)")
+	fs.StringVar(&cmpFile, "c", "", "compare file in xml extension (e.g. Add.xml)")
+	var precedence, eol string
+	opts := analyzeOptions{}
+	opts.tokenizer = tokenizerFlags(fs)
+	fs.StringVar(&opts.exprTree, "exprtree", "", "also write operator precedence trees of the expressions to *E.xml or *E.json (xml or json)")
+	fs.StringVar(&precedence, "precedence", defaultPrecedence, "binary operator precedence for -exprtree, tightest group first, groups separated by ';'")
+	fs.StringVar(&opts.indent, "indent", "  ", "indentation of one nesting level in the parse tree XML")
+	fs.StringVar(&eol, "eol", "lf", "line ending of the XML files (lf or crlf)")
+	if err := fs.Parse(args); err != nil {
+		return "", opts, err
+	}
+	if opts.exprTree != "" && opts.exprTree != "xml" && opts.exprTree != "json" {
+		return "", opts, fmt.Errorf("Unknown expression tree format %s", opts.exprTree)
+	}
+	var ok bool
+	if opts.newline, ok = lineEndings[eol]; !ok {
+		return "", opts, fmt.Errorf("Unknown line ending %s", eol)
+	}
+	table, err := parsePrecedence(precedence)
+	if err != nil {
+		return "", opts, fmt.Errorf("Invalid precedence table: %s", err)
+	}
+	opts.precedence = table
+	return jackSrcFiles, opts, nil
+}
+
+// analyzeOptions configures the default analysis of processJackFile.
+type analyzeOptions struct {
+	tokenizer  *TokenizerOptions
+	exprTree   string // format of the extra expression tree file, if any
+	precedence PrecedenceTable
+	indent     string // indentation of the parse tree XML
+	newline    string // line ending of the XML files
+}
+
+// tokenizerFlags registers the lexical dialect flags shared by all commands.
+func tokenizerFlags(fs *flag.FlagSet) *TokenizerOptions {
+	opts := &TokenizerOptions{}
+	fs.BoolVar(&opts.StringEscapes, "escapes", false, "allow \\\", \\\\ and \\n escape sequences in string constants (extension)")
+	fs.BoolVar(&opts.RadixLiterals, "radix", false, "allow hexadecimal (0x7FFF) and binary (0b1010) integer constants (extension)")
+	fs.BoolVar(&opts.LenientIdentifiers, "compat", false, "lex identifiers leniently like earlier versions (hyphens allowed, 123abc splits silently)")
+	fs.BoolVar(&opts.Strict, "strict", false, "enforce the Jack specification to the letter")
+	return opts
+}
+
+// listJackFiles resolves a source argument, either a .jack file or a
+// directory of them, to the list of files to process.
+func listJackFiles(src string) ([]string, error) {
+	// check if the source is a directory
+	srcStat, err := os.Stat(src)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting source file status %s", err)
+	}
+	if !srcStat.IsDir() {
+		return []string{src}, nil
+	}
+	// get all jack files in the directory
+	jackFiles, err := filepath.Glob(filepath.Join(src, "*.jack"))
+	if err != nil {
+		return nil, fmt.Errorf("Error listing jack files %s: %s", src, err)
+	}
+	if len(jackFiles) == 0 {
+		return nil, fmt.Errorf("No jack files found in %s", src)
+	}
+	return jackFiles, nil
+}
+
+// writeTokensXML lists tokens the way the T.xml files do; the writer escapes
+// the decoded values.
+func writeTokensXML(tokens []Token, x *XMLWriter) {
+	x.Open("tokens")
+	for _, token := range tokens {
+		x.Element(string(token.tokenType), token.tokenValue)
+	}
+	x.Close("tokens")
+}
+
+func processJackFile(jackFile *os.File, opts analyzeOptions) {
 	jackFileContent, err := io.ReadAll(jackFile)
 	if err != nil {
 		fmt.Printf("Error reading jack file %s: %s\n", jackFile.Name(), err)
 		os.Exit(1)
 	}
-	tokenizer, err := NewTokenizer(string(jackFileContent))
+	tokenizer, err := NewTokenizer(string(jackFileContent), *opts.tokenizer)
 	if err != nil {
 		printError(jackFile.Name(), err)
 		os.Exit(1)
 	}
 
 	tokensFile := bytes.Buffer{}
+	tokensXML := NewXMLWriter(&tokensFile, "", opts.newline)
 	tokens := []Token{}
 
 	for {
@@ -102,14 +188,10 @@ func processJackFile(jackFile *os.File) {
 			fmt.Printf("Error advancing tokenizer %s: %s\n", jackFile.Name(), err)
 			os.Exit(1)
 		}
-		tokens = append(tokens, token)
+		tokens = append(tokens, *token)
 	}
 
-	fmt.Fprintf(&tokensFile, "<tokens>\n")
-	for _, token := range tokens {
-		fmt.Fprintf(&tokensFile, "%s\n", token.Tag())
-	}
-	fmt.Fprintf(&tokensFile, "</tokens>\n")
+	writeTokensXML(tokens, tokensXML)
 
 	// create a tokens file with *T.xml
 	if err := os.WriteFile(strings.Replace(jackFile.Name(), ".jack", "T.xml", 1), tokensFile.Bytes(), 0644); err != nil {
@@ -119,25 +201,54 @@ func processJackFile(jackFile *os.File) {
 
 	// create a string buffer instead of a file
 	xmlBuffer := bytes.Buffer{}
-	ce := NewCompilationEngine(tokenizer, &xmlBuffer)
+	ce := NewCompilationEngine(tokenizer, NewXMLWriter(&xmlBuffer, opts.indent, opts.newline))
 	if err := ce.ProcessClass(); err != nil {
 		printError(jackFile.Name(), err)
 		os.Exit(1)
 	}
 
 	xmlFile := strings.Replace(jackFile.Name(), ".jack", ".xml", 1)
-	xmlFileContent := xmlBuffer.String()
-	xmlFileContent = FormatXML(xmlFileContent, "", "  ")
-	if err := os.WriteFile(xmlFile, []byte(xmlFileContent), 0644); err != nil {
+	if err := os.WriteFile(xmlFile, xmlBuffer.Bytes(), 0644); err != nil {
 		fmt.Printf("Error writing xml file %s: %s\n", xmlFile, err)
 		os.Exit(1)
 	}
+
+	if opts.exprTree != "" {
+		// create an expression tree file with *E.xml or *E.json
+		trees := topExpressions(ce.Tree(), opts.precedence)
+		exprFile := strings.Replace(jackFile.Name(), ".jack", "E."+opts.exprTree, 1)
+		content := exprTreesXML(trees)
+		if opts.exprTree == "json" {
+			content = exprTreesJSON(trees)
+		}
+		if err := os.WriteFile(exprFile, []byte(content), 0644); err != nil {
+			fmt.Printf("Error writing expression tree file %s: %s\n", exprFile, err)
+			os.Exit(1)
+		}
+	}
 	println("Compilation engine complete for", jackFile.Name(), " ✅")
 }
 
+// diagnostic formats an error as file:line:col: message, leaving out the
+// stack of the parser.
+func diagnostic(fileName string, err error) string {
+	var e *AnalyzerError
+	switch {
+	case !errors.As(err, &e):
+		return fmt.Sprintf("%s: %s", fileName, err)
+	case e.Col > 0:
+		return fmt.Sprintf("%s:%d:%d: %s", fileName, e.LineNum, e.Col, e.Err)
+	}
+	return fmt.Sprintf("%s:%d: %s", fileName, e.LineNum, e.Err)
+}
+
 func printError(fileName string, err error) {
 	if e, ok := err.(*AnalyzerError); ok {
-		fmt.Printf("Error in file %s:%d -> %s\n\t%s\n", fileName, e.LineNum, e.Err, e.Line)
+		pos := fmt.Sprint(e.LineNum)
+		if e.Col > 0 {
+			pos = fmt.Sprintf("%d:%d", e.LineNum, e.Col)
+		}
+		fmt.Printf("Error in file %s:%s -> %s\n\t%s\n", fileName, pos, e.Err, e.Line)
 		if s := e.Stack; s != "" {
 			println("--------------------------------")
 			fmt.Println(s)
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAnalyzeFlags(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "A.jack")
+	if err := os.WriteFile(path, []byte("class A { field int x; }"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	src, opts, err := parseAnalyzeFlags(flag.NewFlagSet("jack", flag.ContinueOnError), []string{"-s", path, "-indent", "\t", "-eol", "crlf"})
+	if err != nil || src != path {
+		t.Fatalf("parsed %q, %v", src, err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	processJackFile(f, opts)
+	xml, err := os.ReadFile(filepath.Join(dir, "A.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "<class>\r\n\t<keyword> class </keyword>\r\n\t<identifier> A </identifier>\r\n\t<symbol> { </symbol>\r\n" +
+		"\t<classVarDec>\r\n\t\t<keyword> field </keyword>\r\n\t\t<keyword> int </keyword>\r\n\t\t<identifier> x </identifier>\r\n\t\t<symbol> ; </symbol>\r\n\t</classVarDec>\r\n" +
+		"\t<symbol> } </symbol>\r\n</class>\r\n"
+	if string(xml) != want {
+		t.Errorf("A.xml = %q, want %q", xml, want)
+	}
+	tokens, err := os.ReadFile(filepath.Join(dir, "AT.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(tokens), "<tokens>\r\n<keyword> class </keyword>\r\n") {
+		t.Errorf("AT.xml = %q, want unindented crlf lines", tokens)
+	}
+
+	for _, args := range [][]string{{"-eol", "cr"}, {"-exprtree", "yaml"}, {"-precedence", "+;+"}} {
+		if _, _, err := parseAnalyzeFlags(flag.NewFlagSet("jack", flag.ContinueOnError), args); err == nil {
+			t.Errorf("%q accepted", args)
+		}
+	}
+	_, opts, _ = parseAnalyzeFlags(flag.NewFlagSet("jack", flag.ContinueOnError), nil)
+	if opts.indent != "  " || opts.newline != "\n" {
+		t.Errorf("default indent %q and line ending %q", opts.indent, opts.newline)
+	}
+}
+
+func TestStringConstantEscaping(t *testing.T) {
+	src := `class A { function void f() { var String s; let s = "<&>"; return; } }`
+	tokenizer, err := NewTokenizer(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var str *Token
+	for i, token := range tokenizer.Tokens() {
+		if token.tokenType == STRING_CONST {
+			str = &tokenizer.Tokens()[i]
+		}
+	}
+	if str == nil || str.tokenValue != "<&>" {
+		t.Fatalf("string constant token = %+v, want the raw value <&>", str)
+	}
+
+	want := "<stringConstant> &lt;&amp;&gt; </stringConstant>"
+	var tokensXML bytes.Buffer
+	writeTokensXML(tokenizer.Tokens(), NewXMLWriter(&tokensXML, "", "\n"))
+	if !strings.Contains(tokensXML.String(), want) {
+		t.Errorf("T.xml lacks %s:\n%s", want, tokensXML.String())
+	}
+
+	var xml bytes.Buffer
+	if err := NewCompilationEngine(tokenizer, NewXMLWriter(&xml, "  ", "\n")).ProcessClass(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(xml.String(), want) {
+		t.Errorf(".xml lacks %s:\n%s", want, xml.String())
+	}
+	if str.tokenValue != "<&>" {
+		t.Errorf("parsing changed the token value to %q", str.tokenValue)
+	}
+}
+
+func TestDiagnostic(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"class A { function void f() { let x = ; } }", "A.jack:1:39: expected term, got <symbol> ; </symbol>"},
+		{"class A {\n  field int x\n}", "A.jack:3:1: expected symbol ; , got symbol }"},
+		{`class A { function void f() { do g("abc); } }`, "A.jack:1:36: unterminated string literal"},
+	}
+	for _, tt := range tests {
+		_, err := parseSource("A.jack", tt.src, TokenizerOptions{})
+		if err == nil {
+			t.Errorf("%q parsed", tt.src)
+			continue
+		}
+		if got := diagnostic("A.jack", err); got != tt.want {
+			t.Errorf("diagnostic = %q, want %q", got, tt.want)
+		}
+		if got := diagnostic("A.jack", fmt.Errorf("parsing: %w", err)); got != tt.want {
+			t.Errorf("diagnostic of a wrapped error = %q, want %q", got, tt.want)
+		}
+	}
+	if got := diagnostic("A.jack", errNoMoreTokens); got != "A.jack: "+errNoMoreTokens.Error() {
+		t.Errorf("diagnostic of a plain error = %q", got)
+	}
+}
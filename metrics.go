@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+)
+
+// SubroutineMetrics are the size and complexity figures of a subroutine.
+type SubroutineMetrics struct {
+	Class, Name, Kind string
+	Statements        int // statements, nested ones included
+	MaxNesting        int // deepest if/while nesting
+	Complexity        int // cyclomatic complexity: 1 + if and while statements
+	Locals, Params    int
+	ExprDepth         int // deepest expression nesting
+}
+
+// ClassMetrics aggregates the metrics of a class.
+type ClassMetrics struct {
+	Name            string
+	Fields, Statics int
+	Subroutines     []SubroutineMetrics
+}
+
+func measureClass(cd *ClassDecl) ClassMetrics {
+	cm := ClassMetrics{Name: cd.Name}
+	for _, v := range cd.Vars {
+		if v.Kind == KwFIELD {
+			cm.Fields++
+		} else {
+			cm.Statics++
+		}
+	}
+	for _, sd := range cd.Subroutines {
+		sm := SubroutineMetrics{
+			Class:      cd.Name,
+			Name:       sd.Name,
+			Kind:       sd.Kind,
+			Statements: countStatements(sd.Body),
+			MaxNesting: nestingDepth(sd.Body, "ifStatement", "whileStatement"),
+			Complexity: 1 + len(sd.Body.Find("ifStatement")) + len(sd.Body.Find("whileStatement")),
+			Locals:     len(sd.Locals),
+			Params:     len(sd.Params),
+			ExprDepth:  nestingDepth(sd.Body, "expression"),
+		}
+		cm.Subroutines = append(cm.Subroutines, sm)
+	}
+	return cm
+}
+
+// nestingDepth returns how deeply nodes of the given kinds nest under node.
+func nestingDepth(node *Node, kinds ...string) int {
+	deepest := 0
+	for _, c := range node.children {
+		depth := nestingDepth(c, kinds...)
+		for _, kind := range kinds {
+			if c.kind == kind {
+				depth++
+				break
+			}
+		}
+		deepest = max(deepest, depth)
+	}
+	return deepest
+}
+
+// runMetrics implements the metrics command.
+func runMetrics(args []string) {
+	fs := flag.NewFlagSet("metrics", flag.ExitOnError)
+	var src, format, out string
+	fs.StringVar(&src, "s", "", "source file in jack extension or a directory with multiple jack files")
+	fs.StringVar(&format, "format", "table", "output format: table or csv")
+	fs.StringVar(&out, "o", "", "output file (default standard output)")
+	opts := tokenizerFlags(fs)
+	fs.Parse(args)
+	if src == "" {
+		fmt.Println("No source file provided")
+		fs.Usage()
+		os.Exit(1)
+	}
+	if format != "table" && format != "csv" {
+		fmt.Printf("Unknown metrics format %s\n", format)
+		os.Exit(1)
+	}
+
+	w := os.Stdout
+	if out != "" {
+		f, err := os.Create(out)
+		if err != nil {
+			fmt.Printf("Error creating metrics file %s: %s\n", out, err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	metrics := []ClassMetrics{}
+	for _, sf := range loadProject(src, *opts) {
+		metrics = append(metrics, measureClass(declareClass(sf.Tree)))
+	}
+
+	if err := writeMetrics(w, format, metrics); err != nil {
+		fmt.Printf("Error writing metrics: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+// writeMetrics writes one row per class, totalling its subroutines, followed
+// by one row per subroutine, as an aligned table or as CSV.
+func writeMetrics(w io.Writer, format string, metrics []ClassMetrics) error {
+	header := []string{"class", "subroutine", "kind", "statements", "nesting", "complexity", "locals", "params", "exprDepth", "fields", "statics"}
+	rows := [][]string{}
+	for _, cm := range metrics {
+		// the class row totals its subroutines and carries the class variables
+		total := SubroutineMetrics{}
+		for _, sm := range cm.Subroutines {
+			total.Statements += sm.Statements
+			total.MaxNesting = max(total.MaxNesting, sm.MaxNesting)
+			total.Complexity += sm.Complexity
+			total.Locals += sm.Locals
+			total.Params += sm.Params
+			total.ExprDepth = max(total.ExprDepth, sm.ExprDepth)
+		}
+		rows = append(rows, metricsRow(cm.Name, "", KwCLASS, total, strconv.Itoa(cm.Fields), strconv.Itoa(cm.Statics)))
+		for _, sm := range cm.Subroutines {
+			rows = append(rows, metricsRow(cm.Name, sm.Name, sm.Kind, sm, "", ""))
+		}
+	}
+
+	if format == "csv" {
+		cw := csv.NewWriter(w)
+		if err := cw.Write(header); err != nil {
+			return err
+		}
+		// WriteAll flushes and reports the errors of the flush
+		return cw.WriteAll(rows)
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, row := range append([][]string{header}, rows...) {
+		for _, cell := range row {
+			fmt.Fprintf(tw, "%s\t", cell)
+		}
+		fmt.Fprintln(tw)
+	}
+	return tw.Flush()
+}
+
+func metricsRow(class, name, kind string, sm SubroutineMetrics, fields, statics string) []string {
+	return []string{class, name, kind,
+		strconv.Itoa(sm.Statements), strconv.Itoa(sm.MaxNesting), strconv.Itoa(sm.Complexity),
+		strconv.Itoa(sm.Locals), strconv.Itoa(sm.Params), strconv.Itoa(sm.ExprDepth),
+		fields, statics}
+}
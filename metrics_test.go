@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+	"testing"
+)
+
+func TestMeasureClass(t *testing.T) {
+	tests := []struct {
+		name string
+		sub  string
+		want SubroutineMetrics
+	}{
+		{"empty", "function void f() { return; }",
+			SubroutineMetrics{Statements: 1, Complexity: 1}},
+		{"locals and params", "method int f(int a, int b) { var int c, d; var boolean e; let c = a; return c; }",
+			SubroutineMetrics{Statements: 2, Complexity: 1, Locals: 3, Params: 2, ExprDepth: 1}},
+		{"nested statements", "function void f(boolean c) { if (c) { while (c) { if (c) { let c = false; } } } else { let c = true; } return; }",
+			SubroutineMetrics{Statements: 6, MaxNesting: 3, Complexity: 4, Params: 1, ExprDepth: 1}},
+		{"sibling branches", "function void f(boolean c) { if (c) { let c = false; } while (c) { let c = false; } return; }",
+			SubroutineMetrics{Statements: 5, MaxNesting: 1, Complexity: 3, Params: 1, ExprDepth: 1}},
+		{"nested expressions", "function int f(int a) { return (a + (a * a[(a - 1)])) + Math.abs(-a); }",
+			SubroutineMetrics{Statements: 1, Complexity: 1, Params: 1, ExprDepth: 5}},
+	}
+	for _, tt := range tests {
+		_, classes := declareProject(t, "class A {\n\t"+tt.sub+"\n}")
+		cm := measureClass(classes[0])
+		if len(cm.Subroutines) != 1 {
+			t.Fatalf("%s: %d subroutines measured", tt.name, len(cm.Subroutines))
+		}
+		got := cm.Subroutines[0]
+		got.Class, got.Name, got.Kind = "", "", ""
+		if got != tt.want {
+			t.Errorf("%s: metrics %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMeasureClassVariables(t *testing.T) {
+	_, classes := declareProject(t, `class A {
+	field int x, y;
+	static boolean s;
+	field Array z;
+}`)
+	cm := measureClass(classes[0])
+	if cm.Name != "A" || cm.Fields != 3 || cm.Statics != 1 || len(cm.Subroutines) != 0 {
+		t.Errorf("class metrics %+v, want 3 fields and 1 static in A", cm)
+	}
+}
+
+// metricsFixture is a class with two subroutines whose rows the output
+// tests check.
+const metricsFixture = `class A {
+	field int x;
+	static int s;
+	function int f(int a) { var int b; if (a) { let b = a; } return b; }
+	method void g() { while (x) { if (x) { let x = x - 1; } } return; }
+}`
+
+var trailingSpace = regexp.MustCompile(`(?m) +$`)
+
+func TestWriteMetrics(t *testing.T) {
+	_, classes := declareProject(t, metricsFixture)
+	metrics := []ClassMetrics{measureClass(classes[0])}
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"csv", `class,subroutine,kind,statements,nesting,complexity,locals,params,exprDepth,fields,statics
+A,,class,7,2,5,1,1,1,1,1
+A,f,function,3,1,2,1,1,1,,
+A,g,method,4,2,3,0,0,1,,
+`},
+		{"table", `class  subroutine  kind      statements  nesting  complexity  locals  params  exprDepth  fields  statics
+A                  class     7           2        5           1       1       1          1       1
+A      f           function  3           1        2           1       1       1
+A      g           method    4           2        3           0       0       1
+`},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := writeMetrics(&buf, tt.format, metrics); err != nil {
+			t.Fatalf("%s: %s", tt.format, err)
+		}
+		// the cells of the table are padded up to the end of the line
+		got := trailingSpace.ReplaceAllString(buf.String(), "")
+		if got != tt.want {
+			t.Errorf("%s output:\n%s\nwant:\n%s", tt.format, got, tt.want)
+		}
+	}
+}
+
+// failingWriter fails every write.
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) { return 0, errors.New("disk full") }
+
+func TestWriteMetricsError(t *testing.T) {
+	_, classes := declareProject(t, metricsFixture)
+	metrics := []ClassMetrics{measureClass(classes[0])}
+	for _, format := range []string{"csv", "table"} {
+		if err := writeMetrics(failingWriter{}, format, metrics); err == nil || err.Error() != "disk full" {
+			t.Errorf("%s: error %v, want disk full", format, err)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"slices"
+	"strconv"
+)
+
+// constValue returns the 16-bit value of a constant expression tree.
+func constValue(et *ExprTree) (int, bool) {
+	switch {
+	case et.Kind == "int":
+		n, err := strconv.Atoi(et.Value)
+		return n, err == nil
+	case et.Kind == "keyword" && et.Value == KwTRUE:
+		return -1, true
+	case et.Kind == "keyword" && (et.Value == KwFALSE || et.Value == KwNULL):
+		return 0, true
+	}
+	return 0, false
+}
+
+func constTree(n int, like *ExprTree) *ExprTree {
+	return &ExprTree{Kind: "int", Value: strconv.Itoa(int(int16(n))), Line: like.Line, Col: like.Col, token: like.token}
+}
+
+// evalBinary applies an operator with the wrap-around of the Hack ALU;
+// comparisons yield true (-1) or false (0). Division by zero is left for
+// the program to fail on at run time.
+func evalBinary(op string, a, b int) (int, bool) {
+	boolean := func(v bool) int {
+		if v {
+			return -1
+		}
+		return 0
+	}
+	switch op {
+	case SymPLUS:
+		return a + b, true
+	case SymMINUS:
+		return a - b, true
+	case SymSTAR:
+		return a * b, true
+	case SymSLASH:
+		if b == 0 {
+			return 0, false
+		}
+		return a / b, true
+	case SymAMPERSAND:
+		return a & b, true
+	case SymPIPE:
+		return a | b, true
+	case SymLT:
+		return boolean(a < b), true
+	case SymGT:
+		return boolean(a > b), true
+	case SymEQ:
+		return boolean(a == b), true
+	}
+	return 0, false
+}
+
+// fold returns the expression with its constant sub-expressions computed,
+// double negations and complements removed, and additions of constants
+// merged. Operands that are not constant are always kept, so calls and
+// their side effects survive.
+func fold(et *ExprTree) *ExprTree {
+	switch et.Kind {
+	case "unary":
+		operand := fold(et.Operand)
+		if n, ok := constValue(operand); ok {
+			if et.Op == SymMINUS {
+				return constTree(-n, et)
+			}
+			return constTree(^n, et)
+		}
+		if operand.Kind == "unary" && operand.Op == et.Op {
+			// --x and ~~x
+			return operand.Operand
+		}
+		folded := *et
+		folded.Operand = operand
+		return &folded
+	case "binary":
+		return foldBinary(et.Op, fold(et.Left), fold(et.Right), et)
+	case "index":
+		folded := *et
+		folded.Operand = fold(et.Operand)
+		return &folded
+	case "call":
+		folded := *et
+		folded.Args = make([]*ExprTree, len(et.Args))
+		for i, arg := range et.Args {
+			folded.Args[i] = fold(arg)
+		}
+		return &folded
+	}
+	return et
+}
+
+func foldBinary(op string, left, right, like *ExprTree) *ExprTree {
+	l, lok := constValue(left)
+	r, rok := constValue(right)
+	if lok && rok {
+		if n, ok := evalBinary(op, l, r); ok {
+			return constTree(n, like)
+		}
+	}
+	switch {
+	case rok && r == 0 && (op == SymPLUS || op == SymMINUS || op == SymPIPE),
+		rok && r == 1 && (op == SymSTAR || op == SymSLASH),
+		rok && r == -1 && op == SymAMPERSAND:
+		return left
+	case lok && l == 0 && (op == SymPLUS || op == SymPIPE),
+		lok && l == 1 && op == SymSTAR,
+		lok && l == -1 && op == SymAMPERSAND:
+		return right
+	}
+	// (x ± a) ± b becomes x ± c; addition wraps around, so this is exact
+	if rok && (op == SymPLUS || op == SymMINUS) && left.Kind == "binary" &&
+		(left.Op == SymPLUS || left.Op == SymMINUS) {
+		if a, ok := constValue(left.Right); ok {
+			if left.Op == SymMINUS {
+				a = -a
+			}
+			if op == SymMINUS {
+				r = -r
+			}
+			c := int(int16(a + r))
+			if c < 0 && c != -32768 {
+				return foldBinary(SymMINUS, left.Left, constTree(-c, like), like)
+			}
+			return foldBinary(SymPLUS, left.Left, constTree(c, like), like)
+		}
+	}
+	return &ExprTree{Kind: "binary", Op: op, Left: left, Right: right, Line: like.Line, Col: like.Col}
+}
+
+// peephole rewrites the command stream of each function until no rule
+// applies. Labels are local to their function in the VM language.
+func peephole(code []VMCommand) []VMCommand {
+	out := []VMCommand{}
+	for start := 0; start < len(code); {
+		end := start + 1
+		for end < len(code) && code[end].Op != "function" {
+			end++
+		}
+		fn := code[start:end]
+		for {
+			next := dropUnusedLabels(threadJumps(peepholePass(fn)))
+			if slices.Equal(next, fn) {
+				break
+			}
+			fn = next
+		}
+		out = append(out, fn...)
+		start = end
+	}
+	return out
+}
+
+// peepholePass appends the commands one by one, reducing the tail of the
+// output whenever it matches a pattern.
+func peepholePass(fn []VMCommand) []VMCommand {
+	out := []VMCommand{}
+	for _, c := range fn {
+		// nothing after an unconditional jump runs until the next label
+		if n := len(out); n > 0 && (out[n-1].Op == "goto" || out[n-1].Op == "return") && c.Op != "label" {
+			continue
+		}
+		out = append(out, c)
+		for reduceTail(&out) {
+		}
+	}
+	return out
+}
+
+// reduceTail applies the first pattern matching the end of out and tells
+// whether one did.
+func reduceTail(out *[]VMCommand) bool {
+	code := *out
+	tail := func(i int) VMCommand {
+		if i > len(code) {
+			return VMCommand{}
+		}
+		return code[len(code)-i]
+	}
+	isConst := func(c VMCommand) bool { return c.Op == "push" && c.Arg == "constant" }
+	a, b, last := tail(3), tail(2), tail(1)
+	switch {
+	case last.Op == b.Op && (last.Op == "not" || last.Op == "neg"):
+		code = code[:len(code)-2]
+	case last.Op == "if-goto" && isConst(b) && b.Index == 0:
+		// never taken
+		code = code[:len(code)-2]
+	case last.Op == "if-goto" && isConst(b):
+		code = append(code[:len(code)-2], VMCommand{Op: "goto", Arg: last.Arg})
+	case last.Op == "if-goto" && b.Op == "not" && isConst(a) && a.Index == 0:
+		// taken on true
+		code = append(code[:len(code)-3], VMCommand{Op: "goto", Arg: last.Arg})
+	case (last.Op == "add" || last.Op == "sub") && isConst(b) && b.Index == 0:
+		code = code[:len(code)-2]
+	case last.Op == "pop" && b.Op == "push" && b.Arg == last.Arg && b.Index == last.Index:
+		code = code[:len(code)-2]
+	case last.Op == "label" && b.Op == "goto" && b.Arg == last.Arg:
+		code = append(code[:len(code)-2], last)
+	default:
+		return false
+	}
+	*out = code
+	return true
+}
+
+// threadJumps retargets jumps to a label that is immediately followed by a
+// goto, unless the gotos form a cycle.
+func threadJumps(fn []VMCommand) []VMCommand {
+	forward := map[string]string{}
+	for i := 0; i+1 < len(fn); i++ {
+		if fn[i].Op == "label" && fn[i+1].Op == "goto" {
+			forward[fn[i].Arg] = fn[i+1].Arg
+		}
+	}
+	final := func(label string) string {
+		seen := map[string]bool{label: true}
+		target := label
+		for forward[target] != "" {
+			target = forward[target]
+			if seen[target] {
+				return label
+			}
+			seen[target] = true
+		}
+		return target
+	}
+	out := slices.Clone(fn)
+	for i, c := range out {
+		if c.Op == "goto" || c.Op == "if-goto" {
+			out[i].Arg = final(c.Arg)
+		}
+	}
+	return out
+}
+
+func dropUnusedLabels(fn []VMCommand) []VMCommand {
+	used := map[string]bool{}
+	for _, c := range fn {
+		if c.Op == "goto" || c.Op == "if-goto" {
+			used[c.Arg] = true
+		}
+	}
+	return slices.DeleteFunc(fn, func(c VMCommand) bool { return c.Op == "label" && !used[c.Arg] })
+}
+
+// instructionCount counts the commands that execute; labels do not.
+func instructionCount(code []VMCommand) int {
+	n := 0
+	for _, c := range code {
+		if c.Op != "label" {
+			n++
+		}
+	}
+	return n
+}
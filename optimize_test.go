@@ -0,0 +1,133 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFold(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"1 + 2 * 3", "9"},
+		{"32767 + 1", "-32768"},
+		{"-5", "-5"},
+		{"~0", "-1"},
+		{"7 / 2", "3"},
+		{"1 < 2", "-1"},
+		{"true & false", "0"},
+		{"~true | null", "0"},
+		{"x + 0", "x"},
+		{"0 + x", "x"},
+		{"x - 0", "x"},
+		{"x * 1", "x"},
+		{"x / 1", "x"},
+		{"x & -1", "x"},
+		{"x | 0", "x"},
+		{"0 - x", "(0 - x)"},
+		{"--x", "x"},
+		{"~~x", "x"},
+		{"x + 1 + 2", "(x + 3)"},
+		{"x - 1 - 2", "(x - 3)"},
+		{"x + 1 - 3", "(x - 2)"},
+		{"x - 1 + 1", "x"},
+		{"x * 2 * 3", "((x * 2) * 3)"},
+		{"x / 0", "(x / 0)"},
+		{"1 / 0", "(1 / 0)"},
+		{"f(1 + 1) + 0", "f(2)"},
+		{"a[2 * 3]", "a[6]"},
+		{"-(x + 0)", "(-x)"},
+	}
+	for _, tt := range tests {
+		if got := infix(fold(exprTreeOf(t, tt.src, jackPrecedence))); got != tt.want {
+			t.Errorf("fold(%s) = %s, want %s", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestPeephole(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"adding zero", "push local 0\npush constant 0\nadd", "push local 0"},
+		{"double not", "push local 0\nnot\nnot", "push local 0"},
+		{"push then pop to the same place", "push local 0\npop local 0\npush local 1", "push local 1"},
+		{"branch never taken", "push constant 0\nif-goto L\npush local 0\nlabel L", "push local 0"},
+		{"branch always taken", "push constant 1\nif-goto L\npush local 0\nlabel L\npush local 1", "push local 1"},
+		{"goto the next command", "goto L\nlabel L\npush local 0", "push local 0"},
+		{"dead code after return", "return\npush local 0\nlabel L\ngoto L", "return\nlabel L\ngoto L"},
+		{"jump threading", "if-goto A\nif-goto C\nreturn\nlabel A\ngoto B\nlabel C\npush local 0\nlabel B\nreturn",
+			"if-goto B\nif-goto C\nreturn\nlabel C\npush local 0\nlabel B\nreturn"},
+		{"cycle of gotos", "label A\ngoto B\nlabel B\ngoto A", "label A\ngoto A"},
+	}
+	for _, tt := range tests {
+		in, err := parseVM("function A.f 0\n" + tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := strings.TrimSpace(vmText(peephole(in)))
+		if want := "function A.f 0\n" + tt.want; got != want {
+			t.Errorf("%s: peephole gives\n%s\nwant\n%s", tt.name, got, want)
+		}
+	}
+}
+
+// TestOptimizedProgramsBehaveAlike runs programs compiled with and without
+// optimization on the emulator; they must print the same thing while the
+// optimized code executes fewer commands.
+func TestOptimizedProgramsBehaveAlike(t *testing.T) {
+	programs := map[string]string{
+		"arithmetic": `
+		do Output.printInt(1 + 2 * 3);
+		do Output.printInt(32767 + 1);
+		do Output.printInt(-(x + 0) - 1 - 2);
+		do Output.printInt((x + 5) / 1 * 1);
+		do Output.printInt(~~x & -1);`,
+		"branches": `
+		if (true) { do Output.printInt(1); } else { do Output.printInt(2); }
+		if (false) { do Output.printInt(3); }
+		if (~(x = 7)) { do Output.printInt(4); } else { do Output.printInt(5); }
+		while (x > 0) { let x = x - 1 - 1; }
+		do Output.printInt(x);`,
+		"arrays": `
+		var Array a;
+		let a = Array.new(4);
+		let a[0 + 1] = 2 * 3;
+		let a[2] = a[1] + 0;
+		do Output.printInt(a[1 * 2]);
+		do a.dispose();`,
+		"loop that returns": `
+		while (true) {
+			let x = x + 1;
+			if (x > 9) { do Output.printInt(x); return; }
+		}`,
+	}
+	for name, body := range programs {
+		vars, stmts := "", body
+		if before, after, ok := strings.Cut(body, "let a = "); ok {
+			vars, stmts = before, "let a = "+after
+		}
+		src := `class Main {
+	function void main() {
+		var int x;` + vars + `
+		let x = 7;` + stmts + `
+		return;
+	}
+}`
+		plain := compileSources(t, false, src)
+		optimized := compileSources(t, true, src)
+		want := runUnits(t, "", plain).OS.Output()
+		if strings.TrimSpace(want) == "" {
+			t.Fatalf("%s: the program prints nothing", name)
+		}
+		if got := runUnits(t, "", optimized).OS.Output(); got != want {
+			t.Errorf("%s: optimized program prints %q, want %q", name, got, want)
+		}
+		if n, m := instructionCount(optimized[0].Code), instructionCount(plain[0].Code); n >= m {
+			t.Errorf("%s: optimized code has %d commands, unoptimized %d", name, n, m)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// defaultPrecedence lists the binary operators from the tightest binding to
+// the loosest, groups separated by ';'. Jack itself has no precedence, this
+// follows the usual C-like order.
+const defaultPrecedence = "* /;+ -;< > =;&;|"
+
+// jackPrecedence puts every operator in one group, which yields the strict
+// left-to-right evaluation the Jack language specifies.
+const jackPrecedence = "* / + - < > = & |"
+
+// PrecedenceTable maps each binary operator to its binding power; higher
+// binds tighter. All operators are left associative.
+type PrecedenceTable map[string]int
+
+// parsePrecedence reads a table in the defaultPrecedence format. Every
+// operator of opList must appear exactly once.
+func parsePrecedence(spec string) (PrecedenceTable, error) {
+	groups := strings.Split(spec, ";")
+	table := PrecedenceTable{}
+	for i, group := range groups {
+		for _, op := range strings.Fields(group) {
+			if !slices.Contains(opList, op) {
+				return nil, fmt.Errorf("%s is not a binary operator", op)
+			}
+			if _, ok := table[op]; ok {
+				return nil, fmt.Errorf("operator %s appears twice in the precedence table", op)
+			}
+			table[op] = len(groups) - i
+		}
+	}
+	for _, op := range opList {
+		if _, ok := table[op]; !ok {
+			return nil, fmt.Errorf("operator %s is missing from the precedence table", op)
+		}
+	}
+	return table, nil
+}
+
+// ExprTree is an expression rebuilt as a tree that honours operator
+// precedence, in place of the flat term (op term)* list of the grammar.
+type ExprTree struct {
+	Kind    string      `json:"kind"` // binary, unary, int, string, keyword, var, index or call
+	Op      string      `json:"op,omitempty"`
+	Value   string      `json:"value,omitempty"` // constant value, variable or subroutine name
+	Left    *ExprTree   `json:"left,omitempty"`
+	Right   *ExprTree   `json:"right,omitempty"`
+	Operand *ExprTree   `json:"operand,omitempty"` // unary operand or array index
+	Args    []*ExprTree `json:"args,omitempty"`
+	Line    int         `json:"line,omitempty"`
+	Col     int         `json:"col,omitempty"`
+	token   Token       // first token of a leaf, for diagnostics
+}
+
+// buildExprTree applies precedence climbing to an expression node.
+func buildExprTree(expr *Node, table PrecedenceTable) *ExprTree {
+	pb := &precBuilder{table: table}
+	for _, c := range expr.children {
+		if c.kind == "term" {
+			pb.terms = append(pb.terms, c)
+		} else {
+			pb.ops = append(pb.ops, c.token.tokenValue)
+		}
+	}
+	return pb.climb(0)
+}
+
+type precBuilder struct {
+	table PrecedenceTable
+	terms []*Node
+	ops   []string
+	next  int // index of the next term; ops[next-1] precedes it
+}
+
+func (pb *precBuilder) climb(minPrec int) *ExprTree {
+	lhs := pb.term(pb.terms[pb.next])
+	pb.next++
+	for pb.next-1 < len(pb.ops) {
+		op := pb.ops[pb.next-1]
+		prec := pb.table[op]
+		if prec < minPrec {
+			break
+		}
+		rhs := pb.climb(prec + 1)
+		lhs = &ExprTree{Kind: "binary", Op: op, Left: lhs, Right: rhs}
+	}
+	return lhs
+}
+
+// term converts a term node; parentheses only shape the tree.
+func (pb *precBuilder) term(term *Node) *ExprTree {
+	first := term.children[0]
+	tok := *first.token
+	leaf := &ExprTree{Value: tok.tokenValue, Line: tok.lineNum, Col: tok.colNum, token: tok}
+	switch {
+	case tok.Is(SYMBOL, SymLPAREN):
+		return buildExprTree(term.Child("expression"), pb.table)
+	case tok.tokenType == SYMBOL:
+		return &ExprTree{Kind: "unary", Op: leaf.Value, Operand: pb.term(term.Child("term")), Line: leaf.Line, Col: leaf.Col}
+	case tok.tokenType == INT_CONST:
+		leaf.Kind = "int"
+	case tok.tokenType == STRING_CONST:
+		leaf.Kind = "string"
+	case tok.tokenType == KEYWORD:
+		leaf.Kind = "keyword"
+	case term.Child("expressionList") != nil:
+		leaf.Kind = "call"
+		tokens := term.ChildTokens()
+		if tokens[1].Is(SYMBOL, SymDOT) {
+			leaf.Value += "." + tokens[2].tokenValue
+		}
+		for _, arg := range term.Child("expressionList").ChildrenOf("expression") {
+			leaf.Args = append(leaf.Args, buildExprTree(arg, pb.table))
+		}
+	case term.Child("expression") != nil:
+		leaf.Kind = "index"
+		leaf.Operand = buildExprTree(term.Child("expression"), pb.table)
+	default:
+		leaf.Kind = "var"
+	}
+	return leaf
+}
+
+// topExpressions returns the expressions of a tree that are not nested in
+// another expression, each rebuilt with precedence.
+func topExpressions(tree *Node, table PrecedenceTable) []*ExprTree {
+	trees := []*ExprTree{}
+	tree.Walk(func(n *Node) bool {
+		if n.kind != "expression" {
+			return true
+		}
+		et := buildExprTree(n, table)
+		tok, _ := n.FirstToken()
+		et.Line, et.Col = tok.lineNum, tok.colNum
+		trees = append(trees, et)
+		return false
+	})
+	return trees
+}
+
+func exprTreesJSON(trees []*ExprTree) string {
+	buf := bytes.Buffer{}
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	enc.Encode(map[string][]*ExprTree{"expressions": trees})
+	return buf.String()
+}
+
+func exprTreesXML(trees []*ExprTree) string {
+	buf := bytes.Buffer{}
+	buf.WriteString("<expressions>\n")
+	for _, et := range trees {
+		fmt.Fprintf(&buf, "  <expressionTree line=\"%d\" col=\"%d\">\n", et.Line, et.Col)
+		et.writeXML(&buf, 2)
+		buf.WriteString("  </expressionTree>\n")
+	}
+	buf.WriteString("</expressions>\n")
+	return buf.String()
+}
+
+func (et *ExprTree) writeXML(buf *bytes.Buffer, depth int) {
+	indent := strings.Repeat("  ", depth)
+	attrs := ""
+	if et.Op != "" {
+		attrs += fmt.Sprintf(" op=\"%s\"", xmlEscape(et.Op))
+	}
+	if et.Value != "" || et.Kind == "string" {
+		attrs += fmt.Sprintf(" value=\"%s\"", xmlEscape(et.Value))
+	}
+	children := []*ExprTree{}
+	for _, c := range []*ExprTree{et.Left, et.Right, et.Operand} {
+		if c != nil {
+			children = append(children, c)
+		}
+	}
+	children = append(children, et.Args...)
+	if len(children) == 0 {
+		fmt.Fprintf(buf, "%s<%s%s/>\n", indent, et.Kind, attrs)
+		return
+	}
+	fmt.Fprintf(buf, "%s<%s%s>\n", indent, et.Kind, attrs)
+	for _, c := range children {
+		c.writeXML(buf, depth+1)
+	}
+	fmt.Fprintf(buf, "%s</%s>\n", indent, et.Kind)
+}
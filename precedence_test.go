@@ -0,0 +1,91 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// exprTreeOf parses a single expression and rebuilds it with a precedence
+// table.
+func exprTreeOf(t *testing.T, src string, spec string) *ExprTree {
+	t.Helper()
+	table, err := parsePrecedence(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokenizer, err := NewTokenizer(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expr, err := NewCompilationEngine(tokenizer, nil).ParseExpression()
+	if err != nil {
+		t.Fatalf("%s: %s", src, err)
+	}
+	return buildExprTree(expr, table)
+}
+
+// infix renders an expression tree fully parenthesized.
+func infix(et *ExprTree) string {
+	switch et.Kind {
+	case "binary":
+		return "(" + infix(et.Left) + " " + et.Op + " " + infix(et.Right) + ")"
+	case "unary":
+		return "(" + et.Op + infix(et.Operand) + ")"
+	case "index":
+		return et.Value + "[" + infix(et.Operand) + "]"
+	case "call":
+		args := []string{}
+		for _, arg := range et.Args {
+			args = append(args, infix(arg))
+		}
+		return et.Value + "(" + strings.Join(args, ", ") + ")"
+	case "string":
+		return `"` + et.Value + `"`
+	}
+	return et.Value
+}
+
+func TestPrecedence(t *testing.T) {
+	tests := []struct {
+		src  string
+		spec string
+		want string
+	}{
+		{"a + b * c", defaultPrecedence, "(a + (b * c))"},
+		{"a * b + c", defaultPrecedence, "((a * b) + c)"},
+		{"a - b - c", defaultPrecedence, "((a - b) - c)"},
+		{"a / b * c", defaultPrecedence, "((a / b) * c)"},
+		{"a < b & c > d", defaultPrecedence, "((a < b) & (c > d))"},
+		{"a | b & c = d", defaultPrecedence, "(a | (b & (c = d)))"},
+		{"(a + b) * c", defaultPrecedence, "((a + b) * c)"},
+		{"-a * b", defaultPrecedence, "((-a) * b)"},
+		{"~(a = b) | c", defaultPrecedence, "((~(a = b)) | c)"},
+		{"x[i + 1] * 2", defaultPrecedence, "(x[(i + 1)] * 2)"},
+		{"Math.max(a + b * c, 1) - s.length()", defaultPrecedence, "(Math.max((a + (b * c)), 1) - s.length())"},
+		{`"a" = null`, defaultPrecedence, `("a" = null)`},
+		{"a + b * c", "* / + - < > = & |", "((a + b) * c)"},
+		{"a | b & c = d", "* / + - < > = & |", "(((a | b) & c) = d)"},
+		{"a + b * c", "+ -;* /;< > =;&;|", "((a + b) * c)"},
+	}
+	for _, tt := range tests {
+		if got := infix(exprTreeOf(t, tt.src, tt.spec)); got != tt.want {
+			t.Errorf("%s with %q = %s, want %s", tt.src, tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestParsePrecedenceErrors(t *testing.T) {
+	tests := []struct {
+		spec string
+		err  string
+	}{
+		{"* /;+ -;< > =;&", "operator | is missing from the precedence table"},
+		{"* / *;+ -;< > =;&;|", "operator * appears twice in the precedence table"},
+		{"* / %;+ -;< > =;&;|", "% is not a binary operator"},
+	}
+	for _, tt := range tests {
+		if _, err := parsePrecedence(tt.spec); err == nil || err.Error() != tt.err {
+			t.Errorf("%q: error %v, want %q", tt.spec, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SourceFile is a .jack file together with its token stream and parse tree,
+// as consumed by the commands that work on whole projects.
+type SourceFile struct {
+	Path      string
+	Source    string
+	Tokenizer *Tokenizer
+	Tree      *Node
+}
+
+// ClassName returns the name declared by the file's class.
+func (sf *SourceFile) ClassName() string {
+	if tokens := sf.Tree.ChildTokens(); len(tokens) > 1 {
+		return tokens[1].tokenValue
+	}
+	return strings.TrimSuffix(filepath.Base(sf.Path), ".jack")
+}
+
+// parseSource tokenizes and parses a single class.
+func parseSource(path, source string, opts TokenizerOptions) (*SourceFile, error) {
+	tokenizer, err := NewTokenizer(source, opts)
+	if err != nil {
+		return nil, err
+	}
+	ce := NewCompilationEngine(tokenizer, nil)
+	if err := ce.ProcessClass(); err != nil {
+		return nil, err
+	}
+	return &SourceFile{Path: path, Source: source, Tokenizer: tokenizer, Tree: ce.Tree()}, nil
+}
+
+// loadProject parses every .jack file named by src, a file or a directory.
+// Parse errors are printed as positioned diagnostics and abort the program.
+func loadProject(src string, opts TokenizerOptions) []*SourceFile {
+	paths, err := listJackFiles(src)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	files := []*SourceFile{}
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Printf("Error reading jack file %s: %s\n", path, err)
+			os.Exit(1)
+		}
+		sf, err := parseSource(path, string(content), opts)
+		if err != nil {
+			fmt.Println(diagnostic(path, err))
+			os.Exit(1)
+		}
+		files = append(files, sf)
+	}
+	return files
+}
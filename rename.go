@@ -0,0 +1,280 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// renameEdit is one identifier occurrence to rewrite.
+type renameEdit struct {
+	file  *SourceFile
+	token Token
+}
+
+// renameTarget is the symbol a rename applies to, resolved from a
+// Class, Class.member or Class.subroutine.variable path.
+type renameTarget struct {
+	class *ClassDecl
+	sub   *SubroutineDecl // subroutine renamed, or scope of a variable
+	v     *VarDecl        // variable renamed
+}
+
+// runRename implements the rename command.
+func runRename(args []string) {
+	fs := flag.NewFlagSet("rename", flag.ExitOnError)
+	var src, symbol, to string
+	var dryRun bool
+	fs.StringVar(&src, "s", "", "directory with the jack files of the project (or a single jack file)")
+	fs.StringVar(&symbol, "symbol", "", "symbol to rename: Class, Class.subroutine, Class.field or Class.subroutine.variable")
+	fs.StringVar(&to, "to", "", "new name")
+	fs.BoolVar(&dryRun, "dry-run", false, "list the occurrences without rewriting any file")
+	opts := tokenizerFlags(fs)
+	fs.Parse(args)
+	if src == "" || symbol == "" || to == "" {
+		fmt.Println("The -s, -symbol and -to flags are required")
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	files := loadProject(src, *opts)
+	project := map[string]*ClassDecl{}
+	classFiles := map[string]*SourceFile{}
+	for _, sf := range files {
+		project[sf.ClassName()] = declareClass(sf.Tree)
+		classFiles[sf.ClassName()] = sf
+	}
+	target, err := resolveRenameTarget(project, symbol)
+	if err == nil {
+		err = checkRename(project, target, to)
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	oldPath, newPath := "", ""
+	if target.sub == nil && target.v == nil {
+		// refuse before any file is rewritten
+		oldPath, newPath, err = renamedFile(classFiles[target.class.Name], to)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+
+	edits := collectRenames(files, project, target)
+	for _, e := range edits {
+		fmt.Printf("%s:%d:%d: %s -> %s\n", e.file.Path, e.token.lineNum, e.token.colNum, e.token.tokenValue, to)
+	}
+	if dryRun {
+		return
+	}
+	if err := applyRenames(edits, to); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if newPath != "" {
+		if err := os.Rename(oldPath, newPath); err != nil {
+			fmt.Printf("Error renaming %s: %s\n", oldPath, err)
+			os.Exit(1)
+		}
+		fmt.Printf("%s -> %s\n", oldPath, newPath)
+	}
+	fmt.Printf("Renamed %s to %s in %d places ✅\n", symbol, to, len(edits))
+}
+
+// renamedFile returns the path of the file of a renamed class and its new
+// path, or empty paths when the class does not live in the file of its name.
+// A file already at the new path is never overwritten.
+func renamedFile(sf *SourceFile, to string) (oldPath, newPath string, err error) {
+	if strings.TrimSuffix(filepath.Base(sf.Path), ".jack") != sf.ClassName() {
+		return "", "", nil
+	}
+	newPath = filepath.Join(filepath.Dir(sf.Path), to+".jack")
+	if _, err := os.Stat(newPath); err == nil {
+		return "", "", fmt.Errorf("Cannot rename %s: %s already exists", sf.Path, newPath)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return "", "", fmt.Errorf("Error checking %s: %s", newPath, err)
+	}
+	return sf.Path, newPath, nil
+}
+
+func resolveRenameTarget(project map[string]*ClassDecl, symbol string) (renameTarget, error) {
+	parts := strings.Split(symbol, ".")
+	cd, ok := project[parts[0]]
+	if !ok || len(parts) > 3 {
+		return renameTarget{}, fmt.Errorf("Unknown symbol %s", symbol)
+	}
+	target := renameTarget{class: cd}
+	switch len(parts) {
+	case 2:
+		if target.sub = cd.Subroutine(parts[1]); target.sub == nil {
+			target.v = cd.Lookup(nil, parts[1])
+		}
+		if target.sub == nil && target.v == nil {
+			return target, fmt.Errorf("Class %s has no subroutine or variable %s", cd.Name, parts[1])
+		}
+	case 3:
+		if target.sub = cd.Subroutine(parts[1]); target.sub == nil {
+			return target, fmt.Errorf("Class %s has no subroutine %s", cd.Name, parts[1])
+		}
+		target.v = cd.Lookup(target.sub, parts[2])
+		if target.v == nil || (target.v.Kind != KwVAR && target.v.Kind != "argument") {
+			return target, fmt.Errorf("Subroutine %s.%s has no variable %s", cd.Name, parts[1], parts[2])
+		}
+	}
+	return target, nil
+}
+
+// checkRename refuses new names that are not identifiers or that would
+// clash with a symbol of the same scope.
+func checkRename(project map[string]*ClassDecl, target renameTarget, to string) error {
+	if slices.Contains(keywords, to) || checkIdentifier(to) != nil || to == "" {
+		return fmt.Errorf("%s is not a valid identifier", to)
+	}
+	cd := target.class
+	switch {
+	case target.v != nil && target.sub != nil:
+		// a local may not shadow a class variable either
+		if cd.Lookup(target.sub, to) != nil {
+			return fmt.Errorf("%s is already declared in %s.%s", to, cd.Name, target.sub.Name)
+		}
+	case target.v != nil:
+		if cd.Lookup(nil, to) != nil {
+			return fmt.Errorf("%s is already declared in class %s", to, cd.Name)
+		}
+		// nor may a class variable be hidden by an existing local
+		for _, sd := range cd.Subroutines {
+			if v := cd.Lookup(sd, to); v != nil {
+				return fmt.Errorf("%s is already declared in %s.%s", to, cd.Name, sd.Name)
+			}
+		}
+	case target.sub != nil:
+		if cd.Subroutine(to) != nil {
+			return fmt.Errorf("Class %s already has a subroutine %s", cd.Name, to)
+		}
+	default:
+		if _, ok := project[to]; ok {
+			return fmt.Errorf("Class %s already exists", to)
+		}
+	}
+	return nil
+}
+
+// collectRenames finds every definition and reference of the target.
+func collectRenames(files []*SourceFile, project map[string]*ClassDecl, target renameTarget) []renameEdit {
+	edits := []renameEdit{}
+	for _, sf := range files {
+		cd := project[sf.ClassName()]
+		add := func(tok Token) { edits = append(edits, renameEdit{file: sf, token: tok}) }
+		switch {
+		case target.v != nil:
+			if cd != target.class {
+				continue
+			}
+			add(target.v.Token)
+			for _, sd := range cd.Subroutines {
+				if target.sub != nil && sd != target.sub {
+					continue
+				}
+				for _, ref := range cd.References(sd) {
+					if ref.Kind == RefVar && ref.Var == target.v {
+						add(ref.Token)
+					}
+				}
+			}
+		case target.sub != nil:
+			if cd == target.class {
+				add(target.sub.NameToken)
+			}
+			for _, sd := range cd.Subroutines {
+				for _, ref := range cd.References(sd) {
+					if ref.Kind == RefSubroutine && ref.Class == target.class.Name && ref.Token.tokenValue == target.sub.Name {
+						add(ref.Token)
+					}
+				}
+			}
+		default:
+			name := target.class.Name
+			// the class name and every type naming the class
+			sf.Tree.Walk(func(n *Node) bool {
+				switch n.kind {
+				case "class", "classVarDec", "varDec", "subroutineDec", "parameterList":
+					for _, tok := range n.ChildTokens() {
+						if tok.Is(IDENTIFIER, "") && tok.tokenValue == name && isTypeToken(n, tok) {
+							add(tok)
+						}
+					}
+				}
+				return true
+			})
+			for _, sd := range cd.Subroutines {
+				for _, ref := range cd.References(sd) {
+					if ref.Kind == RefClass && ref.Token.tokenValue == name {
+						add(ref.Token)
+					}
+				}
+			}
+		}
+	}
+	sort.SliceStable(edits, func(i, j int) bool {
+		if edits[i].file != edits[j].file {
+			return edits[i].file.Path < edits[j].file.Path
+		}
+		return edits[i].token.offset < edits[j].token.offset
+	})
+	return edits
+}
+
+// isTypeToken reports whether a token of a declaration node is the class
+// name or a type rather than a declared name.
+func isTypeToken(n *Node, tok Token) bool {
+	tokens := n.ChildTokens()
+	for i, t := range tokens {
+		if t.offset != tok.offset {
+			continue
+		}
+		switch n.kind {
+		case "class":
+			return i == 1
+		case "classVarDec", "varDec", "subroutineDec":
+			return i == 1
+		case "parameterList":
+			// type name (, type name)*
+			return i%3 == 0
+		}
+	}
+	return false
+}
+
+// applyRenames rewrites the identifiers in place, file by file, leaving all
+// other text untouched.
+func applyRenames(edits []renameEdit, to string) error {
+	byFile := map[*SourceFile][]Token{}
+	order := []*SourceFile{}
+	for _, e := range edits {
+		if _, ok := byFile[e.file]; !ok {
+			order = append(order, e.file)
+		}
+		byFile[e.file] = append(byFile[e.file], e.token)
+	}
+	for _, sf := range order {
+		tokens := byFile[sf]
+		src := sf.Source
+		// rewrite from the end so earlier offsets stay valid
+		for i := len(tokens) - 1; i >= 0; i-- {
+			tok := tokens[i]
+			src = src[:tok.offset] + to + src[tok.offset+len(tok.lexeme):]
+		}
+		if err := os.WriteFile(sf.Path, []byte(src), 0644); err != nil {
+			return fmt.Errorf("Error writing %s: %s", sf.Path, err)
+		}
+	}
+	return nil
+}
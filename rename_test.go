@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var renameSources = map[string]string{
+	"Main": `class Main {
+	static int count;
+	function void main() {
+		var Point p;
+		var int total;
+		let p = Point.new(1);
+		do p.move(2);
+		let total = p.getX();
+		let count = total;
+		return;
+	}
+}`,
+	"Point": `class Point {
+	field int x;
+	constructor Point new(int ax) {
+		let x = ax;
+		return this;
+	}
+	method void move(int dx) {
+		var int x2;
+		let x = x + dx;
+		do moveTwice();
+		return;
+	}
+	method void moveTwice() { return; }
+	method int getX() { return x; }
+}`,
+}
+
+// renameProject renames a symbol of renameSources in files of a temporary
+// directory and returns the rewritten sources by class.
+func renameProject(t *testing.T, symbol, to string) (map[string]string, error) {
+	t.Helper()
+	dir := t.TempDir()
+	files := []*SourceFile{}
+	project := map[string]*ClassDecl{}
+	for class, src := range renameSources {
+		path := filepath.Join(dir, class+".jack")
+		if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+		sf, err := parseSource(path, src, TokenizerOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, sf)
+		project[class] = declareClass(sf.Tree)
+	}
+	target, err := resolveRenameTarget(project, symbol)
+	if err == nil {
+		err = checkRename(project, target, to)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := applyRenames(collectRenames(files, project, target), to); err != nil {
+		t.Fatal(err)
+	}
+	renamed := map[string]string{}
+	for class := range renameSources {
+		content, err := os.ReadFile(filepath.Join(dir, class+".jack"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		renamed[class] = string(content)
+	}
+	return renamed, nil
+}
+
+func TestRename(t *testing.T) {
+	tests := []struct {
+		symbol, to string
+		edits      map[string][]string // old, new pairs expected in each class
+	}{
+		{"Point.x", "pos", map[string][]string{"Point": {
+			"field int x;", "field int pos;",
+			"let x = ax;", "let pos = ax;",
+			"let x = x + dx;", "let pos = pos + dx;",
+			"return x;", "return pos;"}}},
+		{"Point.move", "moveBy", map[string][]string{
+			"Point": {"void move(", "void moveBy("},
+			"Main":  {"do p.move(2);", "do p.moveBy(2);"}}},
+		{"Point.move.dx", "delta", map[string][]string{"Point": {
+			"int dx)", "int delta)",
+			"x + dx;", "x + delta;"}}},
+		{"Point", "Vector", map[string][]string{
+			"Point": {"class Point", "class Vector", "constructor Point", "constructor Vector"},
+			"Main":  {"var Point p;", "var Vector p;", "Point.new(1)", "Vector.new(1)"}}},
+		{"Main.main.total", "sum", map[string][]string{"Main": {
+			"var int total;", "var int sum;",
+			"let total = p", "let sum = p",
+			"let count = total;", "let count = sum;"}}},
+		{"Main.count", "calls", map[string][]string{"Main": {
+			"static int count;", "static int calls;",
+			"let count = total;", "let calls = total;"}}},
+	}
+	for _, tt := range tests {
+		renamed, err := renameProject(t, tt.symbol, tt.to)
+		if err != nil {
+			t.Errorf("%s: %s", tt.symbol, err)
+			continue
+		}
+		for class, src := range renameSources {
+			want := strings.NewReplacer(tt.edits[class]...).Replace(src)
+			if renamed[class] != want {
+				t.Errorf("renaming %s to %s gives %s:\n%s\nwant:\n%s", tt.symbol, tt.to, class, renamed[class], want)
+			}
+		}
+	}
+}
+
+func TestRenameErrors(t *testing.T) {
+	tests := []struct {
+		symbol, to string
+		err        string
+	}{
+		{"Nope", "X", "Unknown symbol Nope"},
+		{"Point.nope", "y", "Class Point has no subroutine or variable nope"},
+		{"Point.move.x", "y", "Subroutine Point.move has no variable x"},
+		{"Point.x", "while", "while is not a valid identifier"},
+		{"Point.x", "2x", "2x is not a valid identifier"},
+		{"Point.x", "x2", "x2 is already declared in Point.move"},
+		{"Point.move.dx", "x", "x is already declared in Point.move"},
+		{"Point.move", "moveTwice", "Class Point already has a subroutine moveTwice"},
+		{"Point", "Main", "Class Main already exists"},
+	}
+	for _, tt := range tests {
+		if _, err := renameProject(t, tt.symbol, tt.to); err == nil || err.Error() != tt.err {
+			t.Errorf("renaming %s to %s: error %v, want %q", tt.symbol, tt.to, err, tt.err)
+		}
+	}
+}
+
+func TestRenamedFile(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"Point.jack", "Taken.jack"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	point := filepath.Join(dir, "Point.jack")
+	tests := []struct {
+		path, to         string
+		oldPath, newPath string
+		err              string
+	}{
+		{point, "Spot", point, filepath.Join(dir, "Spot.jack"), ""},
+		{point, "Taken", "", "", "Cannot rename " + point + ": " + filepath.Join(dir, "Taken.jack") + " already exists"},
+		{filepath.Join(dir, "Shapes.jack"), "Taken", "", "", ""},
+	}
+	for _, tt := range tests {
+		sf, err := parseSource(tt.path, renameSources["Point"], TokenizerOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		oldPath, newPath, err := renamedFile(sf, tt.to)
+		if oldPath != tt.oldPath || newPath != tt.newPath {
+			t.Errorf("renaming %s to %s: paths %q -> %q, want %q -> %q", tt.path, tt.to, oldPath, newPath, tt.oldPath, tt.newPath)
+		}
+		if got := fmt.Sprint(err); (tt.err == "" && err != nil) || (tt.err != "" && got != tt.err) {
+			t.Errorf("renaming %s to %s: error %v, want %q", tt.path, tt.to, err, tt.err)
+		}
+	}
+}
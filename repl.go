@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// runRepl implements the repl command: an interactive loop that parses
+// Jack expressions, statements, declarations or whole classes and prints
+// their tokens and parse tree.
+func runRepl(args []string) {
+	fs := flag.NewFlagSet("repl", flag.ExitOnError)
+	opts := tokenizerFlags(fs)
+	fs.Parse(args)
+	repl(os.Stdin, os.Stdout, *opts)
+}
+
+type replState struct {
+	out        io.Writer
+	opts       TokenizerOptions
+	showTokens bool
+	showTree   bool
+	showPrec   bool // precedence trees of the expressions
+	precedence PrecedenceTable
+}
+
+func repl(in io.Reader, out io.Writer, opts TokenizerOptions) {
+	precedence, _ := parsePrecedence(defaultPrecedence)
+	rs := &replState{out: out, opts: opts, showTokens: true, showTree: true, precedence: precedence}
+	fmt.Fprintln(out, "Jack REPL - type an expression, statements or a declaration; :help for commands")
+	scanner := bufio.NewScanner(in)
+	input := ""
+	for {
+		if input == "" {
+			fmt.Fprint(out, "jack> ")
+		} else {
+			fmt.Fprint(out, "...> ")
+		}
+		if !scanner.Scan() {
+			fmt.Fprintln(out)
+			return
+		}
+		line := scanner.Text()
+		if input == "" && strings.HasPrefix(strings.TrimSpace(line), ":") {
+			if !rs.command(strings.TrimSpace(line)) {
+				return
+			}
+			continue
+		}
+		input += line + "\n"
+		// keep reading until every brace and parenthesis is closed
+		if !balanced(input, opts) {
+			continue
+		}
+		if strings.TrimSpace(input) != "" {
+			rs.eval(input)
+		}
+		input = ""
+	}
+}
+
+// command runs a :command and reports whether the loop should go on.
+func (rs *replState) command(cmd string) bool {
+	switch cmd {
+	case ":tokens":
+		rs.showTokens = !rs.showTokens
+		fmt.Fprintf(rs.out, "tokens %s\n", onOff(rs.showTokens))
+	case ":tree":
+		rs.showTree = !rs.showTree
+		fmt.Fprintf(rs.out, "tree %s\n", onOff(rs.showTree))
+	case ":prec":
+		rs.showPrec = !rs.showPrec
+		fmt.Fprintf(rs.out, "precedence trees %s\n", onOff(rs.showPrec))
+	case ":quit", ":q":
+		return false
+	case ":help":
+		fmt.Fprintln(rs.out, ":tokens  toggle the token stream\n:tree    toggle the parse tree\n:prec    toggle the operator precedence trees of expressions\n:quit    leave the REPL")
+	default:
+		fmt.Fprintf(rs.out, "unknown command %s, try :help\n", cmd)
+	}
+	return true
+}
+
+func onOff(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
+
+// balanced reports whether the braces and parentheses of the input are
+// closed and its block comments ended, ignoring string constants and
+// comments. With string escapes, \" does not end a string constant.
+func balanced(input string, opts TokenizerOptions) bool {
+	depth, inString := 0, false
+	for i := 0; i < len(input); i++ {
+		c := input[i]
+		switch {
+		case c == '\n':
+			inString = false
+		case inString && opts.StringEscapes && c == '\\' && i+1 < len(input) && input[i+1] != '\n':
+			i++ // skip the escaped character
+		case c == '"':
+			inString = !inString
+		case inString:
+		case c == '/' && i+1 < len(input) && input[i+1] == '/':
+			for i < len(input) && input[i] != '\n' {
+				i++
+			}
+		case c == '/' && i+1 < len(input) && input[i+1] == '*':
+			end := strings.Index(input[i+2:], "*/")
+			if end < 0 {
+				return false
+			}
+			i += 2 + end + 1
+		case c == '{' || c == '(' || c == '[':
+			depth++
+		case c == '}' || c == ')' || c == ']':
+			depth--
+		}
+	}
+	return depth <= 0
+}
+
+func (rs *replState) eval(input string) {
+	tokenizer, err := NewTokenizer(input, rs.opts)
+	if err != nil {
+		rs.printError(err)
+		return
+	}
+	if rs.showTokens {
+		for _, token := range tokenizer.Tokens() {
+			fmt.Fprintln(rs.out, token.Tag())
+		}
+	}
+	tree, err := parseInput(tokenizer)
+	if err != nil {
+		rs.printError(err)
+		return
+	}
+	if rs.showTree && tree != nil {
+		printTree(rs.out, tree, "", "")
+	}
+	if rs.showPrec && tree != nil {
+		fmt.Fprint(rs.out, exprTreesXML(topExpressions(tree, rs.precedence)))
+	}
+}
+
+func (rs *replState) printError(err error) {
+	if e, ok := err.(*AnalyzerError); ok {
+		fmt.Fprintf(rs.out, "error at %d:%d -> %s\n", e.LineNum, e.Col, e.Err)
+		return
+	}
+	fmt.Fprintf(rs.out, "error -> %s\n", err)
+}
+
+// parseInput enters the compilation engine at the rule matching the first
+// token of the input.
+func parseInput(tokenizer *Tokenizer) (*Node, error) {
+	ce := NewCompilationEngine(tokenizer, nil)
+	switch ct := ce.currentToken; {
+	case ct.Is(EOF, ""):
+		return nil, nil
+	case ct.Is(KEYWORD, KwCLASS):
+		return ce.parseFragment(ce.ProcessClass)
+	case ct.IsMulti(KEYWORD, KwSTATIC, KwFIELD):
+		return ce.ParseClassVarDec()
+	case ct.IsMulti(KEYWORD, KwCONSTRUCTOR, KwFUNCTION, KwMETHOD):
+		return ce.ParseSubroutineDec()
+	case ct.Is(KEYWORD, KwVAR):
+		return ce.ParseVarDec()
+	case ct.IsMulti(KEYWORD, KwLET, KwDO, KwIF, KwWHILE, KwRETURN):
+		return ce.ParseStatements()
+	}
+	return ce.ParseExpression()
+}
+
+// printTree draws the parse tree with box drawing characters.
+func printTree(w io.Writer, n *Node, prefix, childPrefix string) {
+	if n.IsToken() {
+		fmt.Fprintf(w, "%s%s %s\n", prefix, n.kind, n.token.tokenValue)
+	} else {
+		fmt.Fprintf(w, "%s%s\n", prefix, n.kind)
+	}
+	for i, c := range n.children {
+		if i == len(n.children)-1 {
+			printTree(w, c, childPrefix+"└─ ", childPrefix+"   ")
+		} else {
+			printTree(w, c, childPrefix+"├─ ", childPrefix+"│  ")
+		}
+	}
+}
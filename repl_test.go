@@ -0,0 +1,153 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBalanced(t *testing.T) {
+	escapes := TokenizerOptions{StringEscapes: true}
+	tests := []struct {
+		input string
+		opts  TokenizerOptions
+		want  bool
+	}{
+		{"1 + 2\n", TokenizerOptions{}, true},
+		{"if (x) {\n", TokenizerOptions{}, false},
+		{"if (x) {\n}\n", TokenizerOptions{}, true},
+		{"f(a[1]\n", TokenizerOptions{}, false},
+		{"let s = \"{\";\n", TokenizerOptions{}, true},
+		{"let x = 1; // {\n", TokenizerOptions{}, true},
+		{"let x = 1; /* } */ {\n", TokenizerOptions{}, false},
+		{"/* {\n", TokenizerOptions{}, false},
+		{"/* {\n } */ x\n", TokenizerOptions{}, true},
+		{"/**/ {\n", TokenizerOptions{}, false},
+		// without escapes, the backslash is a character and the quote ends the string
+		{"let s = \"\\\"; {\n", TokenizerOptions{}, false},
+		{"let s = \"\\\" {\";\n", escapes, true},
+		{"let s = \"\\\\\"; {\n", escapes, false},
+		// a string constant ends with its line
+		{"let s = \"abc\n{\n", TokenizerOptions{}, false},
+		{"let s = \"abc\\\n{\n", escapes, false},
+	}
+	for _, tt := range tests {
+		if got := balanced(tt.input, tt.opts); got != tt.want {
+			t.Errorf("balanced(%q, escapes %v) = %v, want %v", tt.input, tt.opts.StringEscapes, got, tt.want)
+		}
+	}
+}
+
+func TestParseInput(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string // kind of the root of the tree
+	}{
+		{"", ""},
+		{"class A { }", "class"},
+		{"field int x;", "classVarDec"},
+		{"static boolean b;", "classVarDec"},
+		{"function void f() { return; }", "subroutineDec"},
+		{"method int g() { return 1; }", "subroutineDec"},
+		{"var int x;", "varDec"},
+		{"let x = 1; do f();", "statements"},
+		{"return;", "statements"},
+		{"1 + x", "expression"},
+		{"-f(2)", "expression"},
+	}
+	for _, tt := range tests {
+		tokenizer, err := NewTokenizer(tt.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree, err := parseInput(tokenizer)
+		if err != nil {
+			t.Errorf("%q: %s", tt.input, err)
+			continue
+		}
+		got := ""
+		if tree != nil {
+			got = tree.kind
+		}
+		if got != tt.want {
+			t.Errorf("%q parsed as %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestRepl(t *testing.T) {
+	in := strings.Join([]string{
+		"x + 1",
+		":tokens",
+		"if (x) {",
+		"  return;",
+		"}",
+		":tree",
+		"1",
+		":tree",
+		":bogus",
+		"let = 1;",
+		":q",
+		"ignored",
+	}, "\n")
+	var out strings.Builder
+	repl(strings.NewReader(in), &out, TokenizerOptions{})
+	want := `Jack REPL - type an expression, statements or a declaration; :help for commands
+jack> <identifier> x </identifier>
+<symbol> + </symbol>
+<integerConstant> 1 </integerConstant>
+expression
+├─ term
+│  └─ identifier x
+├─ symbol +
+└─ term
+   └─ integerConstant 1
+jack> tokens off
+jack> ...> ...> statements
+└─ ifStatement
+   ├─ keyword if
+   ├─ symbol (
+   ├─ expression
+   │  └─ term
+   │     └─ identifier x
+   ├─ symbol )
+   ├─ symbol {
+   ├─ statements
+   │  └─ returnStatement
+   │     ├─ keyword return
+   │     └─ symbol ;
+   └─ symbol }
+jack> tree off
+jack> jack> tree on
+jack> unknown command :bogus, try :help
+jack> error at 1:5 -> expected identifier  , got symbol =
+jack> `
+	if out.String() != want {
+		t.Errorf("repl output:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestReplPrecedence(t *testing.T) {
+	var out strings.Builder
+	repl(strings.NewReader(":tokens\n:tree\n:prec\n1 + 2 * 3\n:prec\n1\n"), &out, TokenizerOptions{})
+	want := `Jack REPL - type an expression, statements or a declaration; :help for commands
+jack> tokens off
+jack> tree off
+jack> precedence trees on
+jack> <expressions>
+  <expressionTree line="1" col="1">
+    <binary op="+">
+      <int value="1"/>
+      <binary op="*">
+        <int value="2"/>
+        <int value="3"/>
+      </binary>
+    </binary>
+  </expressionTree>
+</expressions>
+jack> precedence trees off
+jack> jack> 
+`
+	if out.String() != want {
+		t.Errorf("repl output:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// runRun implements the run command: the program is compiled, or read from
+// .vm files, and executed by the VM emulator with the native Jack OS.
+func runRun(args []string) {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	var src, input, screen string
+	var optimize, trace, step bool
+	var maxSteps int
+	fs.StringVar(&src, "s", "", "source file in jack or vm extension, or a directory of them")
+	fs.BoolVar(&optimize, "O", false, "optimize the generated VM code")
+	fs.StringVar(&input, "input", "", "keyboard script typed into the program; {up}, {esc}, {f1}... write special keys")
+	fs.StringVar(&screen, "screen", "", "save the screen as a PNG image when the program ends")
+	fs.BoolVar(&trace, "trace", false, "print every executed VM command to standard error")
+	fs.BoolVar(&step, "step", false, "pause before every command: Enter steps, s shows the stack, c continues, q quits")
+	fs.IntVar(&maxSteps, "max-steps", 100_000_000, "stop after this many VM commands (0 for no limit)")
+	opts := tokenizerFlags(fs)
+	fs.Parse(args)
+	if src == "" {
+		fmt.Println("No source file provided")
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	units := loadVMUnits(src, *opts, optimize)
+	prog, err := linkVM(units)
+	if err != nil {
+		fmt.Println("Error linking VM code:", err)
+		os.Exit(1)
+	}
+	keys := []int16{}
+	if input != "" {
+		script, err := os.ReadFile(input)
+		if err != nil {
+			fmt.Printf("Error reading keyboard script %s: %s\n", input, err)
+			os.Exit(1)
+		}
+		if keys, err = parseKeyScript(string(script)); err != nil {
+			fmt.Printf("Error in keyboard script %s: %s\n", input, err)
+			os.Exit(1)
+		}
+	}
+	m, err := NewMachine(prog, NewJackOS(keys))
+	if err != nil {
+		fmt.Println("Error starting the program:", err)
+		os.Exit(1)
+	}
+	if trace {
+		m.Trace = os.Stderr
+	}
+
+	if step {
+		err = stepMachine(m, maxSteps)
+	} else {
+		err = m.Run(maxSteps)
+	}
+	fmt.Print(m.OS.Output())
+	if screen != "" {
+		if err := saveScreen(m, screen); err != nil {
+			fmt.Printf("Error saving screen %s: %s\n", screen, err)
+			os.Exit(1)
+		}
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Printf("Program halted after %d steps ✅\n", m.Steps)
+}
+
+// loadVMUnits compiles the .jack files named by src, or reads its .vm files
+// when src is a .vm file or a directory without Jack sources.
+func loadVMUnits(src string, opts TokenizerOptions, optimize bool) []VMUnit {
+	paths := []string{src}
+	if stat, err := os.Stat(src); err == nil && stat.IsDir() {
+		paths, _ = filepath.Glob(filepath.Join(src, "*.vm"))
+		if jackFiles, _ := filepath.Glob(filepath.Join(src, "*.jack")); len(jackFiles) > 0 {
+			paths = nil
+		}
+	} else if !strings.HasSuffix(src, ".vm") {
+		paths = nil
+	}
+	if paths == nil {
+		return compileProject(src, opts, optimize)
+	}
+	if len(paths) == 0 {
+		fmt.Printf("No jack or vm files found in %s\n", src)
+		os.Exit(1)
+	}
+	units := []VMUnit{}
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Printf("Error reading vm file %s: %s\n", path, err)
+			os.Exit(1)
+		}
+		code, err := parseVM(string(content))
+		if err != nil {
+			fmt.Printf("Error in vm file %s: %s\n", path, err)
+			os.Exit(1)
+		}
+		units = append(units, VMUnit{Class: strings.TrimSuffix(filepath.Base(path), ".vm"), Code: code})
+	}
+	return units
+}
+
+// compileProject compiles every class of a project to VM code in memory.
+func compileProject(src string, opts TokenizerOptions, optimize bool) []VMUnit {
+	units := []VMUnit{}
+	for _, sf := range loadProject(src, opts) {
+		cd := declareClass(sf.Tree)
+		code, err := compileClass(cd, optimize)
+		if err != nil {
+			printError(sf.Path, err)
+			os.Exit(1)
+		}
+		units = append(units, VMUnit{Class: cd.Name, Code: code})
+	}
+	return units
+}
+
+// stepMachine runs the machine one command at a time under the control of
+// standard input.
+func stepMachine(m *Machine, maxSteps int) error {
+	in := bufio.NewReader(os.Stdin)
+	stepping := true
+	for !m.Halted() {
+		if maxSteps > 0 && m.Steps >= maxSteps {
+			return fmt.Errorf("stopped after %d steps in %s", m.Steps, m.Function())
+		}
+		if stepping {
+			fmt.Fprintf(os.Stderr, "%8d  %-28s %-28s > ", m.Steps, m.Function(), m.Next())
+			line, err := in.ReadString('\n')
+			switch strings.TrimSpace(line) {
+			case "c":
+				stepping = false
+			case "q":
+				return fmt.Errorf("quit after %d steps in %s", m.Steps, m.Function())
+			case "s":
+				fmt.Fprintln(os.Stderr, m.stackDump())
+				continue
+			}
+			if err != nil {
+				stepping = false
+			}
+		}
+		if err := m.Step(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stackDump shows the segment pointers and the working stack of the
+// current function.
+func (m *Machine) stackDump() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "SP=%d LCL=%d ARG=%d THIS=%d THAT=%d stack:", m.RAM[ramSP], m.RAM[ramLCL], m.RAM[ramARG], m.RAM[ramTHIS], m.RAM[ramTHAT])
+	for addr := int(m.RAM[ramLCL]); addr < int(m.RAM[ramSP]); addr++ {
+		fmt.Fprintf(&sb, " %d", m.RAM[addr])
+	}
+	return sb.String()
+}
+
+func saveScreen(m *Machine, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return m.WriteScreenPNG(f)
+}
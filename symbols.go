@@ -0,0 +1,126 @@
+package main
+
+// RefKind tells what an identifier inside a subroutine body refers to.
+type RefKind string
+
+const (
+	RefVar        RefKind = "variable"
+	RefClass      RefKind = "class"
+	RefSubroutine RefKind = "subroutine"
+)
+
+// Reference is an identifier used inside a subroutine body, resolved against
+// the scopes of the subroutine and its class.
+type Reference struct {
+	Kind  RefKind
+	Token Token
+	Var   *VarDecl // resolved declaration of a RefVar; nil when undeclared
+	Write bool     // the variable is assigned by a let statement, not read
+	// Subroutine calls only
+	Class    string // class whose subroutine is called; empty when the receiver type is unknown
+	Implicit bool   // unqualified call on the current object or class
+	Args     int    // number of arguments passed
+	Node     *Node  // node holding the call tokens (term or doStatement)
+}
+
+// Lookup resolves a variable name in the scope of a subroutine: locals and
+// parameters first, then the class variables. sd may be nil for the class
+// scope alone.
+func (cd *ClassDecl) Lookup(sd *SubroutineDecl, name string) *VarDecl {
+	if sd != nil {
+		for i := range sd.Locals {
+			if sd.Locals[i].Name == name {
+				return &sd.Locals[i]
+			}
+		}
+		for i := range sd.Params {
+			if sd.Params[i].Name == name {
+				return &sd.Params[i]
+			}
+		}
+	}
+	for i := range cd.Vars {
+		if cd.Vars[i].Name == name {
+			return &cd.Vars[i]
+		}
+	}
+	return nil
+}
+
+// References lists, in source order, every identifier used in the
+// statements of a subroutine.
+func (cd *ClassDecl) References(sd *SubroutineDecl) []Reference {
+	return cd.ReferencesIn(sd, sd.Body)
+}
+
+// ReferencesIn lists the identifiers used under a node of a subroutine body.
+func (cd *ClassDecl) ReferencesIn(sd *SubroutineDecl, node *Node) []Reference {
+	refs := []Reference{}
+	node.Walk(func(n *Node) bool {
+		if n.kind == "varDec" {
+			return false
+		}
+		for i, c := range n.children {
+			if c.kind != string(IDENTIFIER) {
+				continue
+			}
+			refs = append(refs, cd.reference(sd, n, i)...)
+		}
+		return true
+	})
+	return refs
+}
+
+// reference classifies the identifier at children[i] of node from its
+// neighbours, following the letStatement, doStatement and term rules. The
+// qualifier of a call yields a reference of its own, before the call.
+func (cd *ClassDecl) reference(sd *SubroutineDecl, node *Node, i int) []Reference {
+	tok := *node.children[i].token
+	sibling := func(j int) Token {
+		if j < 0 || j >= len(node.children) || !node.children[j].IsToken() {
+			return Token{}
+		}
+		return *node.children[j].token
+	}
+	prev, next := sibling(i-1), sibling(i+1)
+	switch {
+	case prev.Is(SYMBOL, SymDOT):
+		// the subroutine name of a qualified call, handled with its qualifier
+		return nil
+	case next.Is(SYMBOL, SymLPAREN):
+		// unqualified call: a method of this object or a function of this class
+		return []Reference{{Kind: RefSubroutine, Token: tok, Class: cd.Name, Implicit: true,
+			Args: callArgs(node, i+1), Node: node}}
+	case next.Is(SYMBOL, SymDOT):
+		// qualified call; the receiver is a variable or a class name
+		call := Reference{Kind: RefSubroutine, Token: sibling(i + 2), Class: tok.tokenValue,
+			Args: callArgs(node, i+3), Node: node}
+		receiver := Reference{Kind: RefClass, Token: tok}
+		if v := cd.Lookup(sd, tok.tokenValue); v != nil {
+			receiver = Reference{Kind: RefVar, Token: tok, Var: v}
+			call.Class = v.Type
+			if isPrimitiveType(v.Type) {
+				call.Class = ""
+			}
+		}
+		return []Reference{receiver, call}
+	}
+	ref := Reference{Kind: RefVar, Token: tok, Var: cd.Lookup(sd, tok.tokenValue)}
+	ref.Write = node.kind == "letStatement" && i == 1 && !next.Is(SYMBOL, SymLSQBR)
+	return []Reference{ref}
+}
+
+// callArgs counts the expressions of the expressionList following the '('
+// at children[i].
+func callArgs(node *Node, i int) int {
+	for ; i < len(node.children); i++ {
+		if node.children[i].kind == "expressionList" {
+			return len(node.children[i].ChildrenOf("expression"))
+		}
+	}
+	return 0
+}
+
+func isPrimitiveType(typ string) bool {
+	return typ == KwINT || typ == KwCHAR || typ == KwBOOLEAN || typ == KwVOID
+}
@@ -3,22 +3,24 @@ package main
 import (
 	"errors"
 	"fmt"
-	"html"
 	"regexp"
 	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 type TokenType string
 
 const (
-	errorInt = -9999
+	maxIntConst = 32767 // largest integer constant the Jack language allows
 
 	KEYWORD      TokenType = "keyword"
 	SYMBOL       TokenType = "symbol"
 	INT_CONST    TokenType = "integerConstant"
 	STRING_CONST TokenType = "stringConstant"
 	IDENTIFIER   TokenType = "identifier"
+	EOF          TokenType = "eof" // synthetic token returned once the stream is exhausted
 
 	KwCLASS       string = "class"
 	KwCONSTRUCTOR string = "constructor"
@@ -64,7 +66,8 @@ const (
 )
 
 var (
-	errNoMoreTokens = errors.New("no more tokens")
+	errNoMoreTokens     = errors.New("no more tokens")
+	errStrictExtensions = errors.New("strict mode cannot be combined with language extensions or compatibility options")
 
 	keywords = []string{
 		KwCLASS, KwCONSTRUCTOR, KwFUNCTION, KwMETHOD, KwFIELD, KwSTATIC,
@@ -82,10 +85,23 @@ var (
 	keywordRgx        = strings.Join(keywords, "|") // Regex pattern for matching keywords
 	symRgx            = buildSymbolRegex()          // Regex pattern for matching symbols
 	numRgx            = `\d+`                       // Regex pattern for matching integer constants
-	strRgx            = `"[^"\n]*"`                 // Regex pattern for matching string constants (anything between quotes, no newlines)
+	radixRgx          = `0[xXbB]\w+`                // Regex pattern for matching hexadecimal and binary integer constants (extension)
+	strLexRgx         = `"[^"\n]*"?`                // Regex pattern for lexing string constants, also catching unterminated ones
+	strEscLexRgx      = `"(?:[^"\\\n]|\\.)*"?`      // Regex pattern for lexing string constants with escape sequences
 	idRgx             = `[\w\-]+`                   // Regex pattern for matching identifiers (alphanumeric + underscore + hyphen)
+
+	keywordSet = wordSet(keywords)
+	symbolSet  = wordSet(symbols)
 )
 
+func wordSet(words []string) map[string]bool {
+	set := make(map[string]bool, len(words))
+	for _, w := range words {
+		set[w] = true
+	}
+	return set
+}
+
 func buildSymbolRegex() string {
 	escapedSymbols := make([]string, len(symbols))
 	for i, symbol := range symbols {
@@ -94,32 +110,59 @@ func buildSymbolRegex() string {
 	return strings.Join(escapedSymbols, "|")
 }
 
+// TriviaKind classifies the source text found between tokens.
+type TriviaKind string
+
+const (
+	WHITESPACE    TriviaKind = "whitespace"
+	NEWLINE       TriviaKind = "newline"
+	LINE_COMMENT  TriviaKind = "lineComment"
+	BLOCK_COMMENT TriviaKind = "blockComment"
+	DOC_COMMENT   TriviaKind = "docComment" // /** ... */
+	SKIPPED       TriviaKind = "skipped"    // characters the compatibility lexer ignores
+)
+
+// Trivia is a run of source text that carries no meaning for the grammar.
+type Trivia struct {
+	kind TriviaKind
+	text string
+}
+
 type Token struct {
 	tokenType  TokenType
-	tokenValue string
+	tokenValue string // decoded value; output formats escape it themselves
 	lineNum    int
+	colNum     int
+	offset     int    // byte offset of the lexeme in the source
+	lexeme     string // source text of the token, before any decoding
+	leading    []Trivia
+	trailing   []Trivia
 }
 
 func (t Token) Tag() string {
-	return fmt.Sprintf("<%s> %s </%s>", t.tokenType, t.tokenValue, t.tokenType)
+	return "<" + string(t.tokenType) + "> " + xmlEscape(t.tokenValue) + " </" + string(t.tokenType) + ">"
 }
 
-func (t Token) UnescapedValue() string {
-	if t.tokenType == SYMBOL {
-		return html.UnescapeString(t.tokenValue)
+// Text returns the token's source text surrounded by its trivia.
+func (t Token) Text() string {
+	var sb strings.Builder
+	for _, tr := range t.leading {
+		sb.WriteString(tr.text)
 	}
-	return t.tokenValue
+	sb.WriteString(t.lexeme)
+	for _, tr := range t.trailing {
+		sb.WriteString(tr.text)
+	}
+	return sb.String()
 }
 
-func (t Token) Int() int {
+// Int returns the value of an integer constant, which the tokenizer has
+// already checked to be in range.
+func (t Token) Int() (int, error) {
 	if t.tokenType != INT_CONST {
-		return 0
+		return 0, fmt.Errorf("%s %s is not an integer constant", t.tokenType, t.tokenValue)
 	}
-	i, err := strconv.Atoi(t.tokenValue)
-	if err != nil {
-		return errorInt
-	}
-	return i
+	return strconv.Atoi(t.tokenValue)
 }
 
 func (t Token) Require(tok TokenType, val string) bool {
@@ -144,153 +187,464 @@ func (t Token) Is(typ TokenType, val string) bool {
 	if val == "" {
 		return t.tokenType == typ
 	}
-	if typ == SYMBOL {
-		// unescape the value
-		val = html.UnescapeString(val)
-	}
 	return t.tokenType == typ && t.tokenValue == val
 }
 
-type TokenizerLine struct {
-	rawLine string
-	lNumber int
+// TokenizerOptions selects the lexical dialect. The zero value lexes the
+// Jack language as the course tools do.
+type TokenizerOptions struct {
+	// StringEscapes enables the \", \\ and \n escape sequences inside
+	// string constants (extension).
+	StringEscapes bool
+	// RadixLiterals enables hexadecimal (0x7FFF) and binary (0b1010)
+	// integer constants, normalized to decimal in the token stream
+	// (extension).
+	RadixLiterals bool
+	// LenientIdentifiers restores the historical identifier lexing, where
+	// hyphens are part of identifiers and 123abc lexes as an integer
+	// followed by an identifier (compatibility).
+	LenientIdentifiers bool
+	// Strict enforces the Jack specification to the letter, rejecting
+	// anything the course tools would not accept.
+	Strict bool
 }
 
 type Tokenizer struct {
 	source            string
+	opts              TokenizerOptions
 	tokens            []Token
+	eofTrivia         []Trivia
 	currentTokenIndex int
+
+	// scanning state
+	lenientRegex *regexp.Regexp // word patterns of the compatibility lexer
+	pos          int
+	line         int
+	lineStart    int
 }
 
-func NewTokenizer(source string) (*Tokenizer, error) {
-	t := &Tokenizer{source: source, currentTokenIndex: -1}
+func NewTokenizer(source string, opts ...TokenizerOptions) (*Tokenizer, error) {
+	t := &Tokenizer{source: source, currentTokenIndex: -1, line: 1}
+	if len(opts) > 0 {
+		t.opts = opts[0]
+	}
+	if t.opts.Strict && (t.opts.StringEscapes || t.opts.RadixLiterals || t.opts.LenientIdentifiers) {
+		return nil, errStrictExtensions
+	}
+	if err := t.scan(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
 
-	fileLines := strings.Split(t.source, "\n")
-	for i, line := range fileLines {
-		lNumber := i + 1
-		trimmedLine := t.removeComments(line)
-		if trimmedLine == "" {
-			continue
+// scan splits the whole source into tokens. Whitespace and comments become
+// trivia: everything up to the end of a token's line is trailing trivia of
+// that token, anything else is leading trivia of the next one.
+func (t *Tokenizer) scan() error {
+	if t.opts.LenientIdentifiers {
+		stringRgx := strLexRgx
+		if t.opts.StringEscapes {
+			stringRgx = strEscLexRgx
+		}
+		wordRgx := []string{stringRgx, keywordRgx, symRgx, numRgx, idRgx}
+		if t.opts.RadixLiterals {
+			wordRgx = []string{stringRgx, keywordRgx, symRgx, radixRgx, numRgx, idRgx}
 		}
-		tokens, err := t.tokenizeLine(lNumber, trimmedLine)
+		var err error
+		if t.lenientRegex, err = regexp.Compile("^(?:" + strings.Join(wordRgx, "|") + ")"); err != nil {
+			return err
+		}
+	}
+
+	// a token takes about six bytes of typical source
+	t.tokens = make([]Token, 0, len(t.source)/6+16)
+	// The trivia of all the tokens are kept in source order in one array,
+	// where the leading and trailing trivia of each token are contiguous
+	// runs; ends records where each token's runs stop while the array grows.
+	all := []Trivia{}
+	ends := make([][2]int, 0, cap(t.tokens))
+	trailing := false // trivia still belongs to the line of the last token
+	for t.pos < len(t.source) {
+		trivia, err := t.scanTrivia()
 		if err != nil {
-			return nil, &AnalyzerError{
-				Err:     err,
-				Line:    trimmedLine,
-				LineNum: lNumber,
+			return err
+		}
+		length := 0
+		if trivia.kind == "" {
+			length = t.wordLength(t.source[t.pos:])
+			if length == 0 {
+				// only reachable in compatibility mode, which always skipped
+				// characters no token could start with
+				_, size := utf8.DecodeRuneInString(t.source[t.pos:])
+				trivia = Trivia{kind: SKIPPED, text: t.consume(size)}
 			}
 		}
-		t.tokens = append(t.tokens, tokens...)
+		if trivia.kind != "" {
+			all = append(all, trivia)
+			if trailing {
+				ends[len(ends)-1][1] = len(all)
+				trailing = trivia.kind != NEWLINE
+			}
+			continue
+		}
+		token, err := t.scanToken(length)
+		if err != nil {
+			return err
+		}
+		t.tokens = append(t.tokens, token)
+		ends = append(ends, [2]int{len(all), len(all)})
+		trailing = true
 	}
-
-	return t, nil
+	start := 0
+	for i, end := range ends {
+		t.tokens[i].leading = all[start:end[0]:end[0]]
+		if end[1] > end[0] {
+			t.tokens[i].trailing = all[end[0]:end[1]:end[1]]
+		}
+		start = end[1]
+	}
+	t.eofTrivia = all[start:]
+	return nil
 }
 
-func (t *Tokenizer) removeComments(line string) string {
-	line = strings.TrimSpace(line)
-	if line == "" ||
-		strings.HasPrefix(line, "//") ||
-		strings.HasPrefix(line, "/*") ||
-		strings.HasPrefix(line, "*/") ||
-		strings.HasPrefix(line, "*") {
-		return ""
+// scanTrivia consumes the whitespace or comment at the current position, if
+// there is one.
+func (t *Tokenizer) scanTrivia() (Trivia, error) {
+	rest := t.source[t.pos:]
+	switch {
+	case rest[0] == '\n':
+		return Trivia{kind: NEWLINE, text: t.consume(1)}, nil
+	case strings.HasPrefix(rest, "//"):
+		end := strings.IndexByte(rest, '\n')
+		if end == -1 {
+			end = len(rest)
+		}
+		return Trivia{kind: LINE_COMMENT, text: t.consume(end)}, nil
+	case strings.HasPrefix(rest, "/*"):
+		end := strings.Index(rest[2:], "*/")
+		if end == -1 {
+			return Trivia{}, t.errorAt(t.pos, errors.New("unterminated comment"))
+		}
+		kind := BLOCK_COMMENT
+		if strings.HasPrefix(rest, "/**") && end > 0 {
+			kind = DOC_COMMENT
+		}
+		return Trivia{kind: kind, text: t.consume(end + 4)}, nil
 	}
-	segments := strings.Split(line, "//")
-	if len(segments) == 1 {
-		return strings.TrimSpace(line)
+	n := len(rest) - len(strings.TrimLeft(rest, " \t\r\f\v"))
+	if n == 0 {
+		return Trivia{}, nil
 	}
-	return strings.TrimSpace(segments[0])
+	return Trivia{kind: WHITESPACE, text: t.consume(n)}, nil
 }
 
-func (t *Tokenizer) tokenizeLine(lNumber int, line string) ([]Token, error) {
-	wordRgx := []string{keywordRgx, symRgx, numRgx, strRgx, idRgx}
-	wordRegex, err := regexp.Compile(strings.Join(wordRgx, "|"))
-	if err != nil {
-		return nil, err
+// wordLength lexes the token at the start of rest and returns its length.
+// Words are lexed whole and classified afterwards, so that keywords are
+// never split off identifiers and digit-led words can be reported; any
+// other character is a token of its own, rejected by the classification.
+// The compatibility lexer keeps its historical patterns and returns 0 for
+// characters no token can start with.
+func (t *Tokenizer) wordLength(rest string) int {
+	if t.lenientRegex != nil {
+		if loc := t.lenientRegex.FindStringIndex(rest); loc != nil {
+			return loc[1]
+		}
+		return 0
 	}
-	matches := wordRegex.FindAllString(line, -1)
-	tokens := []Token{}
-	for _, match := range matches {
-		tokenType, err := t.getTokenType(match)
-		if err != nil {
-			return nil, err
+	c := rest[0]
+	switch {
+	case c == '"':
+		return t.stringLength(rest)
+	case symbolSet[rest[:1]]:
+		return 1
+	case isWordByte(c):
+		n := 1
+		for n < len(rest) && isWordByte(rest[n]) {
+			n++
 		}
-		switch tokenType {
-		case SYMBOL:
-			match = html.EscapeString(match)
-		case STRING_CONST:
-			match = strings.ReplaceAll(match, "\"", "")
+		return n
+	}
+	_, size := utf8.DecodeRuneInString(rest)
+	return size
+}
+
+// stringLength lexes a string constant up to its closing quote, or up to
+// the end of the line when it is unterminated.
+func (t *Tokenizer) stringLength(rest string) int {
+	n := 1
+	for n < len(rest) {
+		switch rest[n] {
+		case '"':
+			return n + 1
+		case '\n':
+			return n
+		case '\\':
+			if t.opts.StringEscapes {
+				if n+1 == len(rest) || rest[n+1] == '\n' {
+					return n
+				}
+				n++
+			}
 		}
-		tokens = append(tokens, Token{
-			tokenType:  tokenType,
-			tokenValue: match,
-			lineNum:    lNumber,
-		})
+		n++
 	}
-	return tokens, nil
+	return n
 }
 
-func (t *Tokenizer) getTokenType(token string) (TokenType, error) {
-	// use regex to match the token with proper anchoring
-	keywordMatch, err := t.compileAndMatchRgx(token, "^("+keywordRgx+")$")
+// isWordByte matches the \w class: ASCII letters, digits and underscores.
+func isWordByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_'
+}
+
+// scanToken classifies the token of the given length lexed at the current
+// position.
+func (t *Tokenizer) scanToken(length int) (Token, error) {
+	start := t.pos
+	token := Token{lineNum: t.line, colNum: t.pos - t.lineStart + 1, offset: t.pos}
+	match := t.consume(length)
+	token.lexeme = match
+	if strings.HasPrefix(match, "\"") {
+		value, err := t.stringLiteral(match)
+		if err != nil {
+			return Token{}, t.errorAt(start, err)
+		}
+		token.tokenType, token.tokenValue = STRING_CONST, value
+		return token, nil
+	}
+	tokenType, err := t.getTokenType(match)
 	if err != nil {
-		return "", err
+		return Token{}, t.errorAt(start, err)
 	}
-	if keywordMatch {
-		return KEYWORD, nil
+	if t.opts.RadixLiterals && t.isRadixLiteral(match) {
+		tokenType = INT_CONST
+	}
+	switch tokenType {
+	case INT_CONST:
+		match, err = t.intLiteral(match)
+	case IDENTIFIER:
+		if !t.opts.LenientIdentifiers {
+			err = checkIdentifier(match)
+		}
 	}
-	symMatch, err := t.compileAndMatchRgx(token, "^("+symRgx+")$")
 	if err != nil {
-		return "", err
+		return Token{}, t.errorAt(start, err)
 	}
-	if symMatch {
-		return SYMBOL, nil
+	token.tokenType, token.tokenValue = tokenType, match
+	return token, nil
+}
+
+// consume advances the scanner by n bytes, keeping line bookkeeping, and
+// returns the consumed text.
+func (t *Tokenizer) consume(n int) string {
+	text := t.source[t.pos : t.pos+n]
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			t.line++
+			t.lineStart = t.pos + i + 1
+		}
 	}
-	numMatch, err := t.compileAndMatchRgx(token, "^"+numRgx+"$")
-	if err != nil {
-		return "", err
+	t.pos += n
+	return text
+}
+
+// errorAt builds a positioned error for the given source offset.
+func (t *Tokenizer) errorAt(offset int, err error) *AnalyzerError {
+	lineStart := strings.LastIndexByte(t.source[:offset], '\n') + 1
+	lineEnd := strings.IndexByte(t.source[offset:], '\n')
+	if lineEnd == -1 {
+		lineEnd = len(t.source)
+	} else {
+		lineEnd += offset
 	}
-	if numMatch {
-		return INT_CONST, nil
+	return &AnalyzerError{
+		Err:     err,
+		Line:    strings.TrimSpace(t.source[lineStart:lineEnd]),
+		LineNum: strings.Count(t.source[:offset], "\n") + 1,
+		Col:     offset - lineStart + 1,
 	}
-	strMatch, err := t.compileAndMatchRgx(token, "^"+strRgx+"$")
-	if err != nil {
-		return "", err
+}
+
+// Tokens returns the whole token stream, excluding the EOF token.
+func (t *Tokenizer) Tokens() []Token { return t.tokens }
+
+// Render rebuilds the source text from the token stream and its trivia. It
+// is lossless: Render always returns exactly the text that was tokenized.
+func (t *Tokenizer) Render() string {
+	var sb strings.Builder
+	for _, token := range t.tokens {
+		sb.WriteString(token.Text())
 	}
-	if strMatch {
-		return STRING_CONST, nil
+	sb.WriteString(t.eof().Text())
+	return sb.String()
+}
+
+// stringLiteral validates a lexed string constant, quotes included, and
+// returns its value, decoding escape sequences when they are enabled.
+func (t *Tokenizer) stringLiteral(lexeme string) (string, error) {
+	if len(lexeme) < 2 || !strings.HasSuffix(lexeme, "\"") ||
+		(t.opts.StringEscapes && strings.HasSuffix(lexeme, "\\\"") && !t.closesString(lexeme)) {
+		return "", errors.New("unterminated string literal")
 	}
-	idMatch, err := t.compileAndMatchRgx(token, "^"+idRgx+"$")
-	if err != nil {
-		return "", err
+	body := lexeme[1 : len(lexeme)-1]
+	if t.opts.Strict {
+		for _, r := range body {
+			if r < ' ' || r > '~' {
+				return "", fmt.Errorf("character %q is not part of the Jack character set", r)
+			}
+		}
+	}
+	if !t.opts.StringEscapes {
+		return body, nil
+	}
+	var sb strings.Builder
+	for i := 0; i < len(body); i++ {
+		if body[i] != '\\' {
+			sb.WriteByte(body[i])
+			continue
+		}
+		i++
+		switch body[i] {
+		case '"', '\\':
+			sb.WriteByte(body[i])
+		case 'n':
+			sb.WriteByte('\n')
+		default:
+			return "", fmt.Errorf("unknown escape sequence \\%c in string literal", body[i])
+		}
 	}
-	if idMatch {
+	return sb.String(), nil
+}
+
+// checkIdentifier enforces the Jack identifier rule: a letter or underscore
+// followed by letters, digits and underscores.
+func checkIdentifier(lexeme string) error {
+	for i, r := range lexeme {
+		switch {
+		case r == '_' || unicode.IsLetter(r) && r <= unicode.MaxASCII:
+		case unicode.IsDigit(r) && r <= unicode.MaxASCII:
+			if i == 0 {
+				return fmt.Errorf("identifier %s cannot start with a digit", lexeme)
+			}
+		default:
+			return fmt.Errorf("identifier %s contains invalid character %q", lexeme, r)
+		}
+	}
+	return nil
+}
+
+// isRadixLiteral reports whether the lexeme carries a 0x or 0b prefix.
+func (t *Tokenizer) isRadixLiteral(lexeme string) bool {
+	if len(lexeme) < 2 || lexeme[0] != '0' {
+		return false
+	}
+	return strings.ContainsRune("xXbB", rune(lexeme[1]))
+}
+
+// intLiteral validates an integer constant against the Jack range and
+// returns it in decimal form.
+func (t *Tokenizer) intLiteral(lexeme string) (string, error) {
+	base, digits := 10, lexeme
+	if t.opts.RadixLiterals && t.isRadixLiteral(lexeme) {
+		base, digits = 16, lexeme[2:]
+		if lexeme[1] == 'b' || lexeme[1] == 'B' {
+			base = 2
+		}
+	}
+	n, err := strconv.ParseUint(digits, base, 64)
+	if err != nil && !errors.Is(err, strconv.ErrRange) {
+		return "", fmt.Errorf("invalid integer constant %s", lexeme)
+	}
+	if err != nil || n > maxIntConst {
+		return "", fmt.Errorf("integer constant %s is out of range 0..%d", lexeme, maxIntConst)
+	}
+	if base == 10 {
+		return lexeme, nil
+	}
+	return strconv.FormatUint(n, 10), nil
+}
+
+// closesString reports whether the final quote of an escaped string lexeme
+// is a real terminator rather than an escaped \".
+func (t *Tokenizer) closesString(lexeme string) bool {
+	backslashes := 0
+	for i := len(lexeme) - 2; i > 0 && lexeme[i] == '\\'; i-- {
+		backslashes++
+	}
+	return backslashes%2 == 0
+}
+
+// getTokenType classifies a lexed word. It runs once per token, so it
+// looks the word up in sets instead of matching patterns.
+func (t *Tokenizer) getTokenType(token string) (TokenType, error) {
+	switch {
+	case keywordSet[token]:
+		return KEYWORD, nil
+	case symbolSet[token]:
+		return SYMBOL, nil
+	case token != "" && strings.Trim(token, "0123456789") == "":
+		return INT_CONST, nil
+	case token != "" && strings.IndexFunc(token, isNotIdentifierRune) == -1:
 		return IDENTIFIER, nil
 	}
 	return "", errors.New("invalid token: " + token)
 }
 
-func (t *Tokenizer) compileAndMatchRgx(token string, rgx string) (bool, error) {
-	rgxRegex, err := regexp.Compile(rgx)
-	if err != nil {
-		return false, err
-	}
-	return rgxRegex.MatchString(token), nil
+// isNotIdentifierRune rejects what idRgx does not accept: anything but
+// ASCII letters, digits, underscores and hyphens.
+func isNotIdentifierRune(r rune) bool {
+	return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-')
 }
 
 func (t *Tokenizer) Reset() { t.currentTokenIndex = -1 }
 
+// Top returns the token the next call to Advance will return.
 func (t *Tokenizer) Top() Token {
-	if t.currentTokenIndex == -1 {
-		return t.tokens[0]
+	tok, _ := t.Peek(1)
+	return tok
+}
+
+// Peek returns the token n positions past the current one without consuming
+// anything: Peek(0) is the current token and Peek(1) the one the next Advance
+// will return. When the position falls outside the stream it returns the EOF
+// token and false.
+func (t *Tokenizer) Peek(n int) (Token, bool) {
+	i := t.currentTokenIndex + n
+	if i < 0 || i >= len(t.tokens) {
+		return t.eof(), false
 	}
-	return t.tokens[t.currentTokenIndex+1]
+	return t.tokens[i], true
 }
 
-func (t *Tokenizer) Advance() (Token, error) {
-	t.currentTokenIndex++
+// Mark returns the current position in the stream so that a speculative
+// parse can later be undone with Rewind.
+func (t *Tokenizer) Mark() int { return t.currentTokenIndex }
+
+// Rewind restores a position previously obtained from Mark.
+func (t *Tokenizer) Rewind(mark int) { t.currentTokenIndex = mark }
+
+// Advance moves to the next token. Once the stream is exhausted it keeps
+// returning the EOF token together with errNoMoreTokens. The token is shared
+// with the stream and must not be modified.
+func (t *Tokenizer) Advance() (*Token, error) {
+	if t.currentTokenIndex < len(t.tokens) {
+		t.currentTokenIndex++
+	}
 	if t.currentTokenIndex >= len(t.tokens) {
-		return Token{}, errNoMoreTokens
+		eof := t.eof()
+		return &eof, errNoMoreTokens
+	}
+	return &t.tokens[t.currentTokenIndex], nil
+}
+
+// eof builds the EOF token, positioned right after the last real token (or
+// at the end of a source without tokens) and carrying the trivia that
+// follows it.
+func (t *Tokenizer) eof() Token {
+	tok := Token{tokenType: EOF, offset: len(t.source), leading: t.eofTrivia,
+		lineNum: t.line, colNum: len(t.source) - t.lineStart + 1}
+	if n := len(t.tokens); n > 0 {
+		last := t.tokens[n-1]
+		tok.lineNum, tok.colNum = last.lineNum, last.colNum+len(last.lexeme)
 	}
-	return t.tokens[t.currentTokenIndex], nil
+	return tok
 }
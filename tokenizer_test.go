@@ -0,0 +1,198 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestStringConstants(t *testing.T) {
+	escapes := TokenizerOptions{StringEscapes: true}
+	strict := TokenizerOptions{Strict: true}
+	tests := []struct {
+		name string
+		src  string
+		opts TokenizerOptions
+		want string
+		err  string
+	}{
+		{"plain", `"a b"`, TokenizerOptions{}, "a b", ""},
+		{"backslash without escapes", `"a\n"`, TokenizerOptions{}, `a\n`, ""},
+		{"escaped quote", `"say \"hi\""`, escapes, `say "hi"`, ""},
+		{"escaped backslash", `"a\\b"`, escapes, `a\b`, ""},
+		{"escaped backslash before the quote", `"a\\"`, escapes, `a\`, ""},
+		{"newline", `"a\nb"`, escapes, "a\nb", ""},
+		{"unknown escape", `"a\tb"`, escapes, "", `unknown escape sequence \t in string literal`},
+		{"unterminated after an escaped quote", `"abc\"`, escapes, "", "unterminated string literal"},
+		{"unterminated", `"abc`, TokenizerOptions{}, "", "unterminated string literal"},
+		{"strict printable ASCII", `"~ !"`, strict, "~ !", ""},
+		{"strict tab", "\"a\tb\"", strict, "", `character '\t' is not part of the Jack character set`},
+		{"strict non-ASCII", `"café"`, strict, "", `character 'é' is not part of the Jack character set`},
+		{"non-ASCII without strict", `"café"`, TokenizerOptions{}, "café", ""},
+	}
+	for _, tt := range tests {
+		tokenizer, err := NewTokenizer("let s = "+tt.src+";", tt.opts)
+		if tt.err != "" {
+			var ae *AnalyzerError
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: error %v, want %q", tt.name, err, tt.err)
+			} else if !errors.As(err, &ae) || ae.LineNum != 1 || ae.Col != 9 {
+				t.Errorf("%s: error %v is not positioned at 1:9", tt.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+			continue
+		}
+		if token := tokenizer.tokens[3]; token.tokenType != STRING_CONST || token.tokenValue != tt.want {
+			t.Errorf("%s: token %s %q, want a string constant %q", tt.name, token.tokenType, token.tokenValue, tt.want)
+		}
+	}
+
+	if _, err := NewTokenizer("x", TokenizerOptions{Strict: true, StringEscapes: true}); !errors.Is(err, errStrictExtensions) {
+		t.Errorf("strict mode with escapes: error %v, want %v", err, errStrictExtensions)
+	}
+}
+
+func TestIntegerConstants(t *testing.T) {
+	tests := []struct {
+		src  string
+		opts TokenizerOptions
+		want int
+		err  string
+	}{
+		{"0", TokenizerOptions{}, 0, ""},
+		{"32767", TokenizerOptions{}, 32767, ""},
+		{"32768", TokenizerOptions{}, 0, "out of range"},
+		{"99999999999999999999", TokenizerOptions{}, 0, "out of range"},
+		{"0x7FFF", TokenizerOptions{RadixLiterals: true}, 32767, ""},
+		{"0b1010", TokenizerOptions{RadixLiterals: true}, 10, ""},
+		{"0x8000", TokenizerOptions{RadixLiterals: true}, 0, "out of range"},
+		{"0b2", TokenizerOptions{RadixLiterals: true}, 0, "invalid integer constant"},
+	}
+	for _, tt := range tests {
+		tokenizer, err := NewTokenizer("x = "+tt.src+";", tt.opts)
+		if tt.err != "" {
+			var ae *AnalyzerError
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: error %v, want %q", tt.src, err, tt.err)
+			} else if !errors.As(err, &ae) || ae.LineNum != 1 || ae.Col != 5 {
+				t.Errorf("%s: error %v is not positioned at 1:5", tt.src, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.src, err)
+			continue
+		}
+		got, err := tokenizer.tokens[2].Int()
+		if err != nil || got != tt.want {
+			t.Errorf("%s: Int() = %d, %v, want %d", tt.src, got, err, tt.want)
+		}
+	}
+
+	tokenizer, _ := NewTokenizer("x")
+	if _, err := tokenizer.tokens[0].Int(); err == nil {
+		t.Error("Int() of an identifier did not fail")
+	}
+}
+
+func TestIdentifierDiagnostics(t *testing.T) {
+	tests := []struct {
+		src  string
+		opts TokenizerOptions
+		err  string // empty when the class parses
+	}{
+		{"var int my_var;", TokenizerOptions{}, ""},
+		{"var int my-var;", TokenizerOptions{}, "identifier my-var cannot contain '-'"},
+		{"var int 123abc;", TokenizerOptions{}, "identifier 123abc cannot start with a digit"},
+		{"var int my-var;", TokenizerOptions{LenientIdentifiers: true}, ""},
+		{"let x = x-1;", TokenizerOptions{}, ""},
+	}
+	for _, tt := range tests {
+		src := "class A { method void f() { " + tt.src + " return; } }"
+		_, err := parseSource("A.jack", src, tt.opts)
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", tt.src, err)
+		case tt.err != "" && (err == nil || err.Error() != tt.err):
+			t.Errorf("%s: error %v, want %q", tt.src, err, tt.err)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+	}{
+		{"empty", ""},
+		{"whitespace only", " \t\n\r\n  \n"},
+		{"crlf", "class A {\r\n  field int x; // x\r\n}\r\n"},
+		{"star line in a multi-line expression", "let x = a\n  * b\n  * c;\n"},
+		{"doc and block comments", "/** A.\n * doc\n */\nclass A { /* a */ field /**/ int x; }"},
+		{"trailing comment after a brace", "class A {\n} // end\n// more\n"},
+		{"no final newline", "class A { }  "},
+	}
+	for _, tt := range tests {
+		tokenizer, err := NewTokenizer(tt.src)
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		if got := tokenizer.Render(); got != tt.src {
+			t.Errorf("%s: renders to %q", tt.name, got)
+		}
+	}
+}
+
+// triviaTexts joins the texts of trivia.
+func triviaTexts(trivia []Trivia) string {
+	var sb strings.Builder
+	for _, tr := range trivia {
+		sb.WriteString(tr.text)
+	}
+	return sb.String()
+}
+
+func TestTriviaAttachment(t *testing.T) {
+	src := "/** A. */\nclass A { // open\n\n  // x\n  field int x; /* same line */ /* too */\n} // end\n// after\n"
+	tokenizer, err := NewTokenizer(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// each token as leading|lexeme|trailing: the trailing trivia of a token
+	// run up to the end of its line, the rest leads the next token
+	want := []string{
+		"/** A. */\n|class| ",
+		"|A| ",
+		"|{| // open\n",
+		"\n  // x\n  |field| ",
+		"|int| ",
+		"|x|",
+		"|;| /* same line */ /* too */\n",
+		"|}| // end\n",
+	}
+	got := []string{}
+	for _, token := range tokenizer.Tokens() {
+		got = append(got, triviaTexts(token.leading)+"|"+token.lexeme+"|"+triviaTexts(token.trailing))
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("trivia:\n%q\nwant:\n%q", got, want)
+	}
+	if eof := triviaTexts(tokenizer.eof().leading); eof != "// after\n" {
+		t.Errorf("trivia before the end of input %q", eof)
+	}
+	kinds := []TriviaKind{}
+	for _, tr := range tokenizer.Tokens()[3].leading {
+		kinds = append(kinds, tr.kind)
+	}
+	if want := []TriviaKind{NEWLINE, WHITESPACE, LINE_COMMENT, NEWLINE, WHITESPACE}; !slices.Equal(kinds, want) {
+		t.Errorf("kinds of the trivia leading field %v, want %v", kinds, want)
+	}
+	if kind := tokenizer.Tokens()[0].leading[0].kind; kind != DOC_COMMENT {
+		t.Errorf("kind of the class comment %s, want %s", kind, DOC_COMMENT)
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+// Node is a node of the parse tree built by the CompilationEngine. Rule
+// nodes (class, subroutineDec, expression, ...) mirror the tags of the XML
+// output and hold children; token nodes are leaves.
+type Node struct {
+	kind     string // grammar rule, or the token type for leaves
+	token    *Token
+	children []*Node
+	parent   *Node
+	start    int // source offset of the first token
+	end      int // source offset past the last token
+}
+
+// nodeArena hands out the nodes of a parse tree and room for their children
+// from chunks, so that a parse allocates once per chunk rather than once per
+// node. Leaves share the tokens of the stream instead of copying them.
+type nodeArena struct {
+	nodes    []Node
+	children []*Node
+}
+
+const (
+	arenaChunk   = 1024
+	ruleChildren = 4 // room for the children of a rule before add reallocates
+)
+
+func (a *nodeArena) node() *Node {
+	if len(a.nodes) == cap(a.nodes) {
+		a.nodes = make([]Node, 0, arenaChunk)
+	}
+	a.nodes = a.nodes[:len(a.nodes)+1]
+	return &a.nodes[len(a.nodes)-1]
+}
+
+func (a *nodeArena) newRuleNode(kind string) *Node {
+	if len(a.children)+ruleChildren > cap(a.children) {
+		a.children = make([]*Node, 0, arenaChunk*ruleChildren)
+	}
+	i := len(a.children)
+	a.children = a.children[:i+ruleChildren]
+	n := a.node()
+	n.kind, n.children = kind, a.children[i:i:i+ruleChildren]
+	return n
+}
+
+func (a *nodeArena) newTokenNode(token *Token) *Node {
+	n := a.node()
+	n.kind, n.token = string(token.tokenType), token
+	n.start, n.end = token.offset, token.offset+len(token.lexeme)
+	return n
+}
+
+// Span returns the byte range of the source the node covers, trivia around
+// its tokens excluded. An empty rule, such as a parameterList without
+// parameters, covers the empty range where its tokens would have been.
+func (n *Node) Span() (start, end int) { return n.start, n.end }
+
+func (n *Node) add(child *Node) {
+	child.parent = n
+	n.children = append(n.children, child)
+}
+
+// IsToken reports whether the node is a leaf holding a token.
+func (n *Node) IsToken() bool { return n.token != nil }
+
+// Child returns the first direct child of the given kind, or nil.
+func (n *Node) Child(kind string) *Node {
+	for _, c := range n.children {
+		if c.kind == kind {
+			return c
+		}
+	}
+	return nil
+}
+
+// ChildrenOf returns the direct children of the given kind.
+func (n *Node) ChildrenOf(kind string) []*Node {
+	nodes := []*Node{}
+	for _, c := range n.children {
+		if c.kind == kind {
+			nodes = append(nodes, c)
+		}
+	}
+	return nodes
+}
+
+// ChildTokens returns the tokens held directly by the node.
+func (n *Node) ChildTokens() []Token {
+	tokens := []Token{}
+	for _, c := range n.children {
+		if c.IsToken() {
+			tokens = append(tokens, *c.token)
+		}
+	}
+	return tokens
+}
+
+// Tokens returns every token under the node in source order.
+func (n *Node) Tokens() []Token {
+	tokens := []Token{}
+	n.Walk(func(c *Node) bool {
+		if c.IsToken() {
+			tokens = append(tokens, *c.token)
+		}
+		return true
+	})
+	return tokens
+}
+
+// FirstToken returns the first token under the node.
+func (n *Node) FirstToken() (Token, bool) {
+	if n.IsToken() {
+		return *n.token, true
+	}
+	for _, c := range n.children {
+		if tok, ok := c.FirstToken(); ok {
+			return tok, true
+		}
+	}
+	return Token{}, false
+}
+
+// WriteXML writes the node and its descendants as parse tree XML, the
+// output of the CompilationEngine.
+func (n *Node) WriteXML(x *XMLWriter) {
+	if n.IsToken() {
+		x.Element(n.kind, n.token.tokenValue)
+		return
+	}
+	x.Open(n.kind)
+	for _, c := range n.children {
+		c.WriteXML(x)
+	}
+	x.Close(n.kind)
+}
+
+// Walk visits the node and its descendants depth first; returning false from
+// fn skips the children of the visited node.
+func (n *Node) Walk(fn func(*Node) bool) {
+	if !fn(n) {
+		return
+	}
+	for _, c := range n.children {
+		c.Walk(fn)
+	}
+}
+
+// Find returns every descendant of the given kind, in source order.
+func (n *Node) Find(kind string) []*Node {
+	nodes := []*Node{}
+	for _, c := range n.children {
+		c.Walk(func(d *Node) bool {
+			if d.kind == kind {
+				nodes = append(nodes, d)
+			}
+			return true
+		})
+	}
+	return nodes
+}
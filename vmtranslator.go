@@ -0,0 +1,262 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// vmSegmentBases are the pointers of the segments addressed through a base.
+var vmSegmentBases = map[string]string{
+	"local":    "LCL",
+	"argument": "ARG",
+	"this":     "THIS",
+	"that":     "THAT",
+}
+
+// vmTranslator translates linked VM units to Hack assembly.
+type vmTranslator struct {
+	lines    []string
+	class    string // current unit, naming its static variables
+	function string // current function, scoping labels and return addresses
+	labels   int    // counter of generated labels
+}
+
+// translateVM produces the assembly of a whole program. The bootstrap sets
+// SP and calls Sys.init, or Main.main when the program has no Sys.init,
+// then halts in an endless loop. Calls of functions defined in no unit are
+// an error; the Jack OS has to be part of the program.
+func translateVM(units []VMUnit) ([]string, error) {
+	defined := map[string]bool{}
+	for _, unit := range units {
+		for _, c := range unit.Code {
+			if c.Op == "function" {
+				defined[c.Arg] = true
+			}
+		}
+	}
+	missing := map[string]bool{}
+	for _, unit := range units {
+		for _, c := range unit.Code {
+			if c.Op == "call" && !defined[c.Arg] {
+				missing[c.Arg] = true
+			}
+		}
+	}
+	if len(missing) > 0 {
+		names := []string{}
+		for name := range missing {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("undefined functions %s (add the Jack OS to the program with -os)", strings.Join(names, ", "))
+	}
+	entry := "Sys.init"
+	if !defined[entry] {
+		entry = "Main.main"
+	}
+	if !defined[entry] {
+		return nil, fmt.Errorf("the program has no Sys.init or Main.main function")
+	}
+
+	vt := &vmTranslator{function: "bootstrap"}
+	vt.emit("// bootstrap", "@256", "D=A", "@SP", "M=D")
+	vt.call(entry, 0)
+	vt.emit("(bootstrap$halt)", "@bootstrap$halt", "0;JMP")
+	for _, unit := range units {
+		vt.class = unit.Class
+		for _, c := range unit.Code {
+			if err := vt.command(c); err != nil {
+				return nil, fmt.Errorf("%s: %s: %w", unit.Class, c, err)
+			}
+		}
+	}
+	return vt.lines, nil
+}
+
+func (vt *vmTranslator) emit(lines ...string) {
+	vt.lines = append(vt.lines, lines...)
+}
+
+func (vt *vmTranslator) newLabel(kind string) string {
+	vt.labels++
+	return fmt.Sprintf("%s$%s.%d", vt.function, kind, vt.labels)
+}
+
+// pushD pushes the D register.
+func (vt *vmTranslator) pushD() {
+	vt.emit("@SP", "A=M", "M=D", "@SP", "M=M+1")
+}
+
+// popD pops into the D register.
+func (vt *vmTranslator) popD() {
+	vt.emit("@SP", "AM=M-1", "D=M")
+}
+
+func (vt *vmTranslator) command(c VMCommand) error {
+	vt.emit("// " + c.String())
+	switch c.Op {
+	case "push":
+		return vt.push(c.Arg, c.Index)
+	case "pop":
+		return vt.pop(c.Arg, c.Index)
+	case "add", "sub", "and", "or":
+		ops := map[string]string{"add": "M=D+M", "sub": "M=M-D", "and": "M=D&M", "or": "M=D|M"}
+		vt.popD()
+		vt.emit("A=A-1", ops[c.Op])
+	case "neg":
+		vt.emit("@SP", "A=M-1", "M=-M")
+	case "not":
+		vt.emit("@SP", "A=M-1", "M=!M")
+	case "eq", "gt", "lt":
+		vt.compare(c.Op)
+	case "label":
+		vt.emit("(" + vt.function + "$" + c.Arg + ")")
+	case "goto":
+		vt.emit("@"+vt.function+"$"+c.Arg, "0;JMP")
+	case "if-goto":
+		vt.popD()
+		vt.emit("@"+vt.function+"$"+c.Arg, "D;JNE")
+	case "function":
+		vt.function = c.Arg
+		vt.emit("(" + c.Arg + ")")
+		for range c.Index {
+			vt.emit("@SP", "A=M", "M=0", "@SP", "M=M+1")
+		}
+	case "call":
+		vt.call(c.Arg, c.Index)
+	case "return":
+		vt.ret()
+	}
+	return nil
+}
+
+// fixedAddress returns the symbol of a segment entry at a fixed address,
+// or false for the segments addressed through a base pointer.
+func (vt *vmTranslator) fixedAddress(segment string, index int) (string, bool, error) {
+	switch segment {
+	case "temp":
+		if index >= 8 {
+			return "", false, fmt.Errorf("temp %d is out of the segment", index)
+		}
+		return strconv.Itoa(ramTemp + index), true, nil
+	case "pointer":
+		if index >= 2 {
+			return "", false, fmt.Errorf("pointer %d is out of the segment", index)
+		}
+		return []string{"THIS", "THAT"}[index], true, nil
+	case "static":
+		return vt.class + "." + strconv.Itoa(index), true, nil
+	}
+	if _, ok := vmSegmentBases[segment]; !ok {
+		return "", false, fmt.Errorf("unknown segment %s", segment)
+	}
+	return "", false, nil
+}
+
+func (vt *vmTranslator) push(segment string, index int) error {
+	if segment == "constant" {
+		vt.emit("@"+strconv.Itoa(index), "D=A")
+		vt.pushD()
+		return nil
+	}
+	addr, fixed, err := vt.fixedAddress(segment, index)
+	if err != nil {
+		return err
+	}
+	if fixed {
+		vt.emit("@"+addr, "D=M")
+	} else {
+		vt.emit("@"+strconv.Itoa(index), "D=A", "@"+vmSegmentBases[segment], "A=D+M", "D=M")
+	}
+	vt.pushD()
+	return nil
+}
+
+func (vt *vmTranslator) pop(segment string, index int) error {
+	if segment == "constant" {
+		return fmt.Errorf("cannot pop to the constant segment")
+	}
+	addr, fixed, err := vt.fixedAddress(segment, index)
+	if err != nil {
+		return err
+	}
+	if fixed {
+		vt.popD()
+		vt.emit("@"+addr, "M=D")
+		return nil
+	}
+	// the target address waits in R13 while the value is popped
+	vt.emit("@"+strconv.Itoa(index), "D=A", "@"+vmSegmentBases[segment], "D=D+M", "@R13", "M=D")
+	vt.popD()
+	vt.emit("@R13", "A=M", "M=D")
+	return nil
+}
+
+// compare replaces the two top values with true (-1) or false (0). For gt
+// and lt, operands of different signs are decided by their signs, since
+// their difference can overflow.
+func (vt *vmTranslator) compare(op string) {
+	jump := map[string]string{"eq": "JEQ", "gt": "JGT", "lt": "JLT"}[op]
+	decide, isTrue, done := vt.newLabel("decide"), vt.newLabel("true"), vt.newLabel("done")
+	vt.popD()
+	if op == "eq" {
+		vt.emit("A=A-1", "D=M-D")
+	} else {
+		// R13 keeps b while the signs are looked at; D ends up with the
+		// sign of a - b
+		aNeg, same := vt.newLabel("aneg"), vt.newLabel("same")
+		vt.emit("@R13", "M=D", "@SP", "A=M-1", "D=M", "@"+aNeg, "D;JLT")
+		vt.emit("@R13", "D=M", "@"+same, "D;JGE")
+		vt.emit("D=1", "@"+decide, "0;JMP")
+		vt.emit("("+aNeg+")", "@R13", "D=M", "@"+same, "D;JLT")
+		vt.emit("D=-1", "@"+decide, "0;JMP")
+		vt.emit("("+same+")", "@R13", "D=M", "@SP", "A=M-1", "D=M-D")
+	}
+	vt.emit("("+decide+")", "@"+isTrue, "D;"+jump)
+	vt.emit("@SP", "A=M-1", "M=0", "@"+done, "0;JMP")
+	vt.emit("("+isTrue+")", "@SP", "A=M-1", "M=-1")
+	vt.emit("(" + done + ")")
+}
+
+// call saves the caller's frame and jumps to the function.
+func (vt *vmTranslator) call(name string, n int) {
+	ret := vt.newLabel("ret")
+	vt.emit("@"+ret, "D=A")
+	vt.pushD()
+	for _, ptr := range []string{"LCL", "ARG", "THIS", "THAT"} {
+		vt.emit("@"+ptr, "D=M")
+		vt.pushD()
+	}
+	vt.emit("@SP", "D=M", "@"+strconv.Itoa(n+5), "D=D-A", "@ARG", "M=D")
+	vt.emit("@SP", "D=M", "@LCL", "M=D")
+	vt.emit("@"+name, "0;JMP", "("+ret+")")
+}
+
+// ret restores the caller's frame; R13 holds the frame and R14 the return
+// address, read before the return value can overwrite it.
+func (vt *vmTranslator) ret() {
+	vt.emit("@LCL", "D=M", "@R13", "M=D")
+	vt.emit("@5", "A=D-A", "D=M", "@R14", "M=D")
+	vt.popD()
+	vt.emit("@ARG", "A=M", "M=D")
+	vt.emit("@ARG", "D=M+1", "@SP", "M=D")
+	for _, ptr := range []string{"THAT", "THIS", "ARG", "LCL"} {
+		vt.emit("@R13", "AM=M-1", "D=M", "@"+ptr, "M=D")
+	}
+	vt.emit("@R14", "A=M", "0;JMP")
+}
+
+// asmText renders assembly lines, indenting everything but the labels.
+func asmText(lines []string) string {
+	var sb strings.Builder
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "(") {
+			sb.WriteString("    ")
+		}
+		sb.WriteString(line)
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
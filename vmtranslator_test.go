@@ -0,0 +1,150 @@
+package main
+
+import (
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// tinyVM calls a function, compares numbers of different signs and stores
+// the results in Main's static variables, RAM[16] and RAM[17].
+const tinyVM = `function Main.main 0
+push constant 21
+call Main.double 1
+pop static 0
+push constant 32767
+neg
+push constant 2
+lt
+pop static 1
+push constant 0
+return
+function Main.double 0
+push argument 0
+push argument 0
+add
+return
+`
+
+// runHack executes Hack binary code until it jumps back to the A
+// instruction loading the jump target, the halt loop of the bootstrap, and
+// returns the RAM.
+func runHack(t *testing.T, binary []string) []int16 {
+	t.Helper()
+	ram := make([]int16, 32768)
+	var a, d int16
+	for pc, steps := 0, 0; ; steps++ {
+		if steps > 100000 {
+			t.Fatal("the program does not halt")
+		}
+		in := binary[pc]
+		if in[0] == '0' {
+			n, _ := strconv.ParseInt(in, 2, 32)
+			a, pc = int16(n), pc+1
+			continue
+		}
+		x, y, c := d, a, in[4:10]
+		if in[3] == '1' {
+			y = ram[uint16(a)]
+		}
+		if c[0] == '1' {
+			x = 0
+		}
+		if c[1] == '1' {
+			x = ^x
+		}
+		if c[2] == '1' {
+			y = 0
+		}
+		if c[3] == '1' {
+			y = ^y
+		}
+		out := x & y
+		if c[4] == '1' {
+			out = x + y
+		}
+		if c[5] == '1' {
+			out = ^out
+		}
+		addr := a
+		if in[12] == '1' {
+			ram[uint16(addr)] = out
+		}
+		if in[10] == '1' {
+			a = out
+		}
+		if in[11] == '1' {
+			d = out
+		}
+		jump := in[13] == '1' && out < 0 || in[14] == '1' && out == 0 || in[15] == '1' && out > 0
+		if !jump {
+			pc++
+		} else if int(uint16(a)) == pc-1 {
+			return ram
+		} else {
+			pc = int(uint16(a))
+		}
+	}
+}
+
+func TestTranslateGolden(t *testing.T) {
+	code, err := parseVM(tinyVM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	asm, err := translateVM([]VMUnit{{Class: "Main", Code: code}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary, err := assemble(asm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ram := runHack(t, binary)
+	if ram[16] != 42 || ram[17] != -1 {
+		t.Errorf("Main.0, Main.1 = %d, %d, want 42, -1", ram[16], ram[17])
+	}
+	// the value returned by Main.main is left on the stack
+	if ram[ramSP] != 257 || ram[256] != 0 {
+		t.Errorf("SP = %d, RAM[256] = %d after Main.main returned, want 257, 0", ram[ramSP], ram[256])
+	}
+
+	golden, err := os.ReadFile("testdata/Tiny.hack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Fields(string(golden))
+	if !slices.Equal(binary, want) {
+		for i := range min(len(binary), len(want)) {
+			if binary[i] != want[i] {
+				t.Fatalf("instruction %d is %s, want %s from testdata/Tiny.hack", i, binary[i], want[i])
+			}
+		}
+		t.Fatalf("%d instructions, want %d from testdata/Tiny.hack", len(binary), len(want))
+	}
+}
+
+func TestTranslateErrors(t *testing.T) {
+	tests := []struct {
+		vm  string
+		err string
+	}{
+		{"function Main.main 0\ncall Math.multiply 2\nreturn", "undefined functions Math.multiply (add the Jack OS to the program with -os)"},
+		{"function Foo.bar 0\nreturn", "the program has no Sys.init or Main.main function"},
+		{"function Main.main 0\npop constant 0", "Main: pop constant 0: cannot pop to the constant segment"},
+		{"function Main.main 0\npush temp 8", "Main: push temp 8: temp 8 is out of the segment"},
+		{"function Main.main 0\npush pointer 2", "Main: push pointer 2: pointer 2 is out of the segment"},
+		{"function Main.main 0\npush heap 0", "Main: push heap 0: unknown segment heap"},
+	}
+	for _, tt := range tests {
+		code, err := parseVM(tt.vm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := translateVM([]VMUnit{{Class: "Main", Code: code}}); err == nil || err.Error() != tt.err {
+			t.Errorf("%q: error %v, want %q", tt.vm, err, tt.err)
+		}
+	}
+}
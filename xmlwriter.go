@@ -0,0 +1,89 @@
+package main
+
+import (
+	"io"
+	"strings"
+)
+
+// xmlEscaper escapes text and double-quoted attribute values for the XML
+// and HTML outputs. Every emitter goes through it, so that the token values
+// themselves are never escaped.
+var xmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+
+func xmlEscape(s string) string { return xmlEscaper.Replace(s) }
+
+// XMLWriter writes indented XML while the elements are opened and closed,
+// with no pass over the finished output. Every line ends with the line
+// ending; an element holding only text stays on one line, and so does an
+// element closed right after it was opened.
+type XMLWriter struct {
+	w       io.Writer
+	indent  string
+	newline string
+	depth   int
+	margins []string // indentation of each depth reached so far
+	pending bool     // the last element opened has no content yet
+	err     error
+}
+
+// NewXMLWriter writes to w, indenting each nesting level by indent and
+// ending lines with newline.
+func NewXMLWriter(w io.Writer, indent, newline string) *XMLWriter {
+	return &XMLWriter{w: w, indent: indent, newline: newline}
+}
+
+// Open starts an element whose content follows on the next lines.
+func (x *XMLWriter) Open(tag string) {
+	x.flushPending()
+	x.startLine()
+	x.write("<", tag, ">")
+	x.pending = true
+	x.depth++
+}
+
+// Close ends the innermost open element.
+func (x *XMLWriter) Close(tag string) {
+	x.depth--
+	if x.pending {
+		x.pending = false
+	} else {
+		x.startLine()
+	}
+	x.write("</", tag, ">", x.newline)
+}
+
+// Element writes an element holding text, escaped, on a line of its own.
+func (x *XMLWriter) Element(tag, text string) {
+	x.flushPending()
+	x.startLine()
+	x.write("<", tag, "> ", xmlEscape(text), " </", tag, ">", x.newline)
+}
+
+// Err returns the first error of the underlying writer.
+func (x *XMLWriter) Err() error { return x.err }
+
+func (x *XMLWriter) flushPending() {
+	if x.pending {
+		x.write(x.newline)
+		x.pending = false
+	}
+}
+
+func (x *XMLWriter) startLine() {
+	for len(x.margins) <= x.depth {
+		x.margins = append(x.margins, strings.Repeat(x.indent, len(x.margins)))
+	}
+	x.write(x.margins[x.depth])
+}
+
+func (x *XMLWriter) write(parts ...string) {
+	for _, s := range parts {
+		if x.err != nil {
+			return
+		}
+		_, x.err = io.WriteString(x.w, s)
+	}
+}
+
+// lineEndings are the line endings selectable for XML output.
+var lineEndings = map[string]string{"lf": "\n", "crlf": "\r\n"}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestXMLWriter(t *testing.T) {
+	tests := []struct {
+		name            string
+		indent, newline string
+		write           func(x *XMLWriter)
+		want            string
+	}{
+		{"empty element", "  ", "\n", func(x *XMLWriter) {
+			x.Open("a")
+			x.Close("a")
+		}, "<a></a>\n"},
+		{"empty element inside another", "  ", "\n", func(x *XMLWriter) {
+			x.Open("a")
+			x.Open("b")
+			x.Close("b")
+			x.Close("a")
+		}, "<a>\n  <b></b>\n</a>\n"},
+		{"nesting with a custom indent", "\t", "\n", func(x *XMLWriter) {
+			x.Open("a")
+			x.Open("b")
+			x.Element("c", "1")
+			x.Close("b")
+			x.Element("d", "2")
+			x.Close("a")
+		}, "<a>\n\t<b>\n\t\t<c> 1 </c>\n\t</b>\n\t<d> 2 </d>\n</a>\n"},
+		{"crlf", "", "\r\n", func(x *XMLWriter) {
+			x.Open("a")
+			x.Element("b", "x")
+			x.Open("c")
+			x.Close("c")
+			x.Close("a")
+		}, "<a>\r\n<b> x </b>\r\n<c></c>\r\n</a>\r\n"},
+		{"escaped text", "  ", "\n", func(x *XMLWriter) {
+			x.Element("s", `<&>"`)
+		}, "<s> &lt;&amp;&gt;&quot; </s>\n"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		x := NewXMLWriter(&buf, tt.indent, tt.newline)
+		tt.write(x)
+		if x.Err() != nil {
+			t.Errorf("%s: %s", tt.name, x.Err())
+		}
+		if buf.String() != tt.want {
+			t.Errorf("%s: wrote %q, want %q", tt.name, buf.String(), tt.want)
+		}
+	}
+}
+
+// limitedWriter fails once n bytes have been written.
+type limitedWriter struct {
+	n     int
+	calls int
+}
+
+var errWriterFull = errors.New("writer full")
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	w.calls++
+	if len(p) > w.n {
+		n := w.n
+		w.n = 0
+		return n, errWriterFull
+	}
+	w.n -= len(p)
+	return len(p), nil
+}
+
+func TestXMLWriterErr(t *testing.T) {
+	w := &limitedWriter{n: 5}
+	x := NewXMLWriter(w, "  ", "\n")
+	x.Open("class")
+	x.Element("keyword", "class")
+	calls := w.calls
+	x.Element("identifier", "A")
+	x.Close("class")
+	if !errors.Is(x.Err(), errWriterFull) {
+		t.Errorf("Err() = %v, want %v", x.Err(), errWriterFull)
+	}
+	if w.calls != calls {
+		t.Errorf("%d writes after the first error", w.calls-calls)
+	}
+}